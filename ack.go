@@ -0,0 +1,73 @@
+//go:build !windows
+// +build !windows
+
+package seamless
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// ackFDEnv is the environment variable giving the daemon the file descriptor
+// of the handoff acknowledgment pipe opened by the launcher.
+const ackFDEnv = "SEAMLESS_ACK_FD"
+
+// launcherAck is the write end of the handoff acknowledgment pipe inherited
+// from the launcher, nil if none.
+var launcherAck *os.File
+
+// openLauncherAck opens the handoff acknowledgment pipe passed by the
+// launcher, if any.
+func openLauncherAck() {
+	s := os.Getenv(ackFDEnv)
+	if s == "" {
+		return
+	}
+	// The descriptor is not valid for the processes we start.
+	os.Unsetenv(ackFDEnv)
+	fd, err := strconv.Atoi(s)
+	if err != nil || fd < 3 {
+		LogError("Ignoring "+ackFDEnv, fmt.Errorf("invalid file descriptor %q", s))
+		return
+	}
+	syscall.CloseOnExec(fd)
+	launcherAck = os.NewFile(uintptr(fd), "ack")
+}
+
+// ackHandoff writes the handoff acknowledgment to the launcher. It must be
+// called before the parent term signal is sent, so the launcher can tell the
+// signal from an unrelated one (see SetParentTermSignal).
+func ackHandoff() {
+	if launcherAck == nil {
+		return
+	}
+	if _, err := launcherAck.Write([]byte{1}); err != nil {
+		LogError("Could not acknowledge the handoff to the launcher", err)
+	}
+}
+
+// newAckPipe creates the handoff acknowledgment pipe. The write end w is
+// passed to the child, and acks receives a value for each acknowledgment
+// written by the child. Closing r stops the reading of acks.
+func newAckPipe() (r, w *os.File, acks <-chan struct{}, err error) {
+	r, w, err = os.Pipe()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	c := make(chan struct{}, 1)
+	go func() {
+		b := make([]byte, 1)
+		for {
+			if _, err := r.Read(b); err != nil {
+				return
+			}
+			select {
+			case c <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return r, w, c, nil
+}
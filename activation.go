@@ -0,0 +1,84 @@
+//go:build !windows
+// +build !windows
+
+package seamless
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket
+// activation.
+const listenFDsStart = 3
+
+// listenFDs returns the number of file descriptors passed to the process
+// identified by pid using the systemd socket activation convention.
+func listenFDs(pid int) int {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(pid) {
+		return 0
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// activationFiles returns the socket activation file descriptors received by
+// the launcher so they can be forwarded to the daemon.
+func activationFiles() []*os.File {
+	n := listenFDs(os.Getpid())
+	files := make([]*os.File, 0, n)
+	for fd := listenFDsStart; fd < listenFDsStart+n; fd++ {
+		files = append(files, os.NewFile(uintptr(fd), fmt.Sprintf("LISTEN_FD_%d", fd)))
+	}
+	return files
+}
+
+// InheritListeners returns the listeners passed to the daemon using the systemd
+// socket activation convention (LISTEN_FDS and LISTEN_PID environment
+// variables). When socket activation is used, the listening sockets are owned
+// by systemd and the launcher forwards them to the daemon, so each generation
+// of the daemon can accept on the same sockets without having to rebind them.
+//
+// The old daemon has nothing to mark for inheritance: daemon generations are
+// not exec'ed from one another but all started by the launcher, which keeps
+// the file descriptors received from systemd open and passes them to each
+// daemon it starts. The sockets thus outlive every generation. In re-exec
+// mode, where the old instance execs the new one, the listeners to pass are
+// registered with ShareListeners.
+//
+// If no file descriptors are inherited, InheritListeners returns no listeners
+// and no error, so the caller can fallback to create its own listeners.
+func InheritListeners() ([]net.Listener, error) {
+	n := listenFDs(os.Getpid())
+	if n == 0 && os.Getenv("SEAMLESS") == strconv.Itoa(os.Getppid()) {
+		// The launcher forwarded its own socket activation file descriptors.
+		n = listenFDs(os.Getppid())
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	ls := make([]net.Listener, 0, n)
+	for fd := listenFDsStart; fd < listenFDsStart+n; fd++ {
+		syscall.CloseOnExec(fd)
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("LISTEN_FD_%d", fd))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range ls {
+				l.Close()
+			}
+			return nil, fmt.Errorf("cannot inherit listener from fd %d: %v", fd, err)
+		}
+		ls = append(ls, l)
+	}
+	return ls, nil
+}
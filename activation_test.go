@@ -0,0 +1,38 @@
+//go:build !windows
+// +build !windows
+
+package seamless
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestInheritListenersNone(t *testing.T) {
+	tests := []struct {
+		name      string
+		listenPID string
+		listenFDs string
+	}{
+		{"fresh start", "", ""},
+		{"other process", strconv.Itoa(os.Getppid()), "1"},
+		{"malformed", strconv.Itoa(os.Getpid()), "x"},
+		{"negative", strconv.Itoa(os.Getpid()), "-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Not started by a launcher.
+			t.Setenv("SEAMLESS", "")
+			t.Setenv("LISTEN_PID", tt.listenPID)
+			t.Setenv("LISTEN_FDS", tt.listenFDs)
+			ls, err := InheritListeners()
+			if err != nil {
+				t.Fatalf("InheritListeners() error = %v", err)
+			}
+			if len(ls) != 0 {
+				t.Errorf("InheritListeners() = %d listeners, want none", len(ls))
+			}
+		})
+	}
+}
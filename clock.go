@@ -0,0 +1,19 @@
+package seamless
+
+import "time"
+
+// clock abstracts the time functions used by the restart timeouts so they can
+// be tested without real sleeps.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// clk is the clock used by seamless. It is a variable so it can be replaced in
+// tests.
+var clk clock = realClock{}
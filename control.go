@@ -0,0 +1,114 @@
+package seamless
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// controlTimeout is the maximum duration of the control socket handshake.
+const controlTimeout = 5 * time.Second
+
+var (
+	controlPath string
+	// controlCh receives a value when a new daemon announced itself on the
+	// control socket.
+	controlCh = make(chan struct{}, 1)
+	// controlListener is the control socket listener, nil if not listening.
+	controlListener net.Listener
+)
+
+// UseControlSocket makes the new and old daemons coordinate over a Unix domain
+// socket at path instead of signaling the old daemon using the PID found in
+// the PID file. The new daemon connects to the socket, announces itself and
+// waits for the old daemon to acknowledge before it takes over the socket. On
+// acknowledge, the old daemon engages its graceful shutdown as if it had
+// received the TERM signal.
+//
+// The PID file is still written so seamless falls back to the PID file mode
+// if the control socket is not available.
+func UseControlSocket(path string) {
+	if defaultController.inited {
+		panic("seamless.UseControlSocket must be called before seamless.Init")
+	}
+	controlPath = path
+}
+
+// notifyControl announces the current process to the old daemon listening on
+// the control socket. It returns true if the old daemon acknowledged.
+func notifyControl() bool {
+	conn, err := net.DialTimeout("unix", controlPath, controlTimeout)
+	if err != nil {
+		// No old daemon listening, fallback to PID file.
+		return false
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(controlTimeout))
+	if _, err = fmt.Fprintf(conn, "seamless hello %d\n", os.Getpid()); err != nil {
+		LogError("Control socket handshake error", err)
+		return false
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		LogError("Control socket handshake error", err)
+		return false
+	}
+	var pid int
+	if _, err := fmt.Sscanf(line, "seamless bye %d\n", &pid); err != nil {
+		LogError("Control socket handshake error", fmt.Errorf("invalid reply: %q", line))
+		return false
+	}
+	LogMessage(fmt.Sprintf("Old process %d notified over control socket", pid))
+	return true
+}
+
+// listenControl takes over the control socket so the next generation of the
+// daemon can notify the current one.
+func listenControl() {
+	if err := os.Remove(controlPath); err != nil && !os.IsNotExist(err) {
+		LogError("Could not remove old control socket", err)
+	}
+	l, err := net.Listen("unix", controlPath)
+	if err != nil {
+		LogError("Could not create control socket, falling back to PID file", err)
+		return
+	}
+	// The next generation takes the socket path over, it must not be
+	// unlinked when closed.
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	controlListener = l
+	ch := controlCh
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				LogError("Control socket error", err)
+				return
+			}
+			handleControl(conn, ch)
+		}
+	}()
+}
+
+// handleControl handles the announcement of a new daemon on conn, and reports
+// it on ch.
+func handleControl(conn net.Conn, ch chan struct{}) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(controlTimeout))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "seamless hello ") {
+		LogError("Control socket handshake error", fmt.Errorf("invalid message: %q", line))
+		return
+	}
+	if _, err = fmt.Fprintf(conn, "seamless bye %d\n", os.Getpid()); err != nil {
+		LogError("Control socket handshake error", err)
+		return
+	}
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
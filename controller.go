@@ -0,0 +1,116 @@
+package seamless
+
+import (
+	"net"
+	"os"
+	"sync"
+)
+
+// Controller holds the state of the seamless restart lifecycle of a daemon:
+// its initialization, PID file, registered callbacks, restart state and
+// metrics. The package level functions operate on the default controller (see
+// DefaultController), which is all most programs need.
+//
+// The launcher, the signals and the settings configured with the Set*
+// functions are process-wide and shared by all controllers. As a consequence,
+// only the default controller can be initialized in launcher or re-exec mode
+// (Init, InitReExec): additional controllers are initialized with
+// InitNoLauncher, each with its own PID file, and engage their graceful
+// shutdown on TERM. The systemd notifications, the control socket and the
+// Unix sockets created with ListenUnix are handled by the default controller
+// only.
+type Controller struct {
+	inited         bool
+	disabled       bool
+	reexecMode     bool
+	noLauncherMode bool
+	started        int32
+	restartAborted int32
+	degraded       int32
+	startedOnce    sync.Once
+	doneCh         chan struct{}
+	pidFilePath    string
+	workers        InFlight
+	listeners      []net.Listener
+
+	hooksMu              sync.Mutex
+	shutdownRequestFuncs []func()
+	shutdownFuncs        []shutdownFunc
+	drainStartFuncs      []func() error
+	startedFuncs         []func()
+	pidFileWrittenFuncs  []func(path string)
+	onExitFuncs          []func()
+	degradedFuncs        []func()
+
+	stateMu            sync.Mutex
+	state              State
+	onStateChangeFuncs []func(old, new State)
+
+	metricsMu sync.Mutex
+	metrics   Metrics
+}
+
+// NewController returns a new uninitialized Controller.
+func NewController() *Controller {
+	return &Controller{doneCh: make(chan struct{})}
+}
+
+// defaultController is the Controller used by the package level functions.
+var defaultController = NewController()
+
+// DefaultController returns the Controller used by the package level
+// functions.
+func DefaultController() *Controller {
+	return defaultController
+}
+
+// isDefault reports whether c is the default controller, the only one handling
+// process-wide resources.
+func (c *Controller) isDefault() bool {
+	return c == defaultController
+}
+
+// sdNotify sends state to systemd on behalf of the default controller.
+func (c *Controller) sdNotify(state string) {
+	if c.isDefault() {
+		sdNotify(state)
+	}
+}
+
+// termC returns a channel receiving the TERM signal.
+func (c *Controller) termC() chan os.Signal {
+	if c.isDefault() {
+		return notifyTerm()
+	}
+	return notifyTermShared()
+}
+
+// controlC returns the channel receiving the new daemon announcements on the
+// control socket, or nil if c does not handle the control socket.
+func (c *Controller) controlC() <-chan struct{} {
+	if c.isDefault() {
+		return controlCh
+	}
+	return nil
+}
+
+// Enabled reports whether c has been initialized with seamless restart
+// enabled.
+func (c *Controller) Enabled() bool {
+	return c.inited && !c.disabled
+}
+
+// PIDFilePath is like the package level PIDFilePath function, operating on c.
+func (c *Controller) PIDFilePath() string {
+	if !c.Enabled() {
+		return ""
+	}
+	return c.pidFilePath
+}
+
+// disable turns c off. As no restart will ever happen, doneCh is closed so
+// Wait does not block forever.
+func (c *Controller) disable() {
+	c.disabled = true
+	close(c.doneCh)
+}
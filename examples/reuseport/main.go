@@ -1,18 +1,14 @@
 package main
 
 import (
-	"context"
 	"flag"
 	"fmt"
 	"log"
-	"net"
 	"net/http"
 	"os"
-	"syscall"
 	"time"
 
 	"github.com/rs/seamless"
-	"golang.org/x/sys/unix"
 )
 
 var (
@@ -31,19 +27,7 @@ func main() {
 	// same host:port. Using the capability, the new daemon can listen while
 	// the old daemon is still bound, allowing seemless transition from one
 	// process to the other.
-	lc := net.ListenConfig{
-		Control: func(network, address string, c syscall.RawConn) error {
-			var sysErr error
-			err := c.Control(func(fd uintptr) {
-				sysErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, unix.SO_REUSEPORT, 1)
-			})
-			if err != nil {
-				return err
-			}
-			return sysErr
-		},
-	}
-	l, err := lc.Listen(context.TODO(), "tcp", *listen)
+	l, err := seamless.ListenReusePort("tcp", *listen)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -62,14 +46,7 @@ func main() {
 
 	// Implement the graceful shutdown that will be triggered once the new process
 	// successfully rebound the socket.
-	seamless.OnShutdown(func() {
-		ctx, cancel := context.WithTimeout(context.Background(), *gracefulTimeout)
-		defer cancel()
-		if err := s.Shutdown(ctx); err != nil {
-			log.Print("Graceful shutdown timeout, force closing")
-			s.Close()
-		}
-	})
+	seamless.OnShutdownServer(s, *gracefulTimeout)
 
 	go func() {
 		// Give the server a second to start
@@ -1,11 +1,9 @@
 package main
 
 import (
-	"context"
 	"flag"
 	"fmt"
 	"log"
-	"net"
 	"net/http"
 	"os"
 	"time"
@@ -25,20 +23,16 @@ func init() {
 }
 
 func main() {
-	// Listen on unix socket. We first remove the socket if already exit (see
-	// below).
-	os.Remove(*sockPath)
-	l, err := net.ListenUnix("unix", &net.UnixAddr{Net: "unix", Name: *sockPath})
+	// Listen on unix socket. Any existing socket, like one left by a crashed
+	// process, is removed first and the automatic removal of the socket on
+	// close is disabled. This way, the old process can keep the previous socket
+	// available as long as possible, and seamless removes the socket file on
+	// exit only if no new process took it over.
+	l, err := seamless.ListenUnix(*sockPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Disable automatic removal of unix socket on close. With this strategy, it
-	// is the new process which is responsible for cleaning up the socket. This
-	// way, the old process can keep the previous socket available as long as
-	// possible.
-	l.SetUnlinkOnClose(false)
-
 	s := &http.Server{
 		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if d := r.URL.Query().Get("delay"); d != "" {
@@ -53,14 +47,7 @@ func main() {
 
 	// Implement the graceful shutdown that will be triggered once the new process
 	// successfully rebound the socket.
-	seamless.OnShutdown(func() {
-		ctx, cancel := context.WithTimeout(context.Background(), *gracefulTimeout)
-		defer cancel()
-		if err := s.Shutdown(ctx); err != nil {
-			log.Print("Graceful shutdown timeout, force closing")
-			s.Close()
-		}
-	})
+	seamless.OnShutdownServer(s, *gracefulTimeout)
 
 	go func() {
 		// Give the server a second to start
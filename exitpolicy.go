@@ -0,0 +1,56 @@
+package seamless
+
+import "time"
+
+// LauncherExitPolicy defines when the launcher exits once the daemon is ready
+// for the restart (see SetLauncherExitPolicy).
+type LauncherExitPolicy int
+
+const (
+	// ExitOnHandoff makes the launcher exit as soon as the daemon signals it
+	// is ready for the new daemon to start. This is the default.
+	ExitOnHandoff LauncherExitPolicy = iota
+	// WaitForNewBound makes the launcher wait, once the daemon signaled it is
+	// ready, for a new generation of the daemon to call Started (i.e. to
+	// write its PID in the PID file) before exiting.
+	WaitForNewBound
+)
+
+var launcherExitPolicy = ExitOnHandoff
+
+// boundPollInterval is the interval at which the launcher checks the PID
+// file for a new generation with the WaitForNewBound policy.
+const boundPollInterval = 100 * time.Millisecond
+
+// SetLauncherExitPolicy sets when the launcher exits during a restart. With
+// the default ExitOnHandoff policy, the launcher exits as soon as the daemon is
+// ready for the handoff, so the supervisor starts the new daemon right away.
+//
+// With WaitForNewBound, the launcher only exits once a new generation called
+// Started, for supervisors tracking a single process at a time which would
+// otherwise see a moment with no process. The new generation must then be
+// started by something else than the launcher exit, like a deployment tool
+// starting it alongside the old one. As a supervisor waiting for the launcher
+// to exit before starting the new generation would never do so, the launcher
+// exits anyway if no new generation is bound within the handoff timeout (see
+// SetHandoffTimeout).
+func SetLauncherExitPolicy(policy LauncherExitPolicy) {
+	if defaultController.inited {
+		panic("seamless.SetLauncherExitPolicy must be called before seamless.Init")
+	}
+	launcherExitPolicy = policy
+}
+
+// newGenerationBound reports whether the PID file of the default controller
+// holds the PID of a live process other than old.
+func newGenerationBound(old int) bool {
+	b, err := readPIDFile(defaultController.pidFilePath)
+	if err != nil {
+		return false
+	}
+	info, err := parsePIDFile(b)
+	if err != nil {
+		return false
+	}
+	return info.PID != old && processAlive(info.PID)
+}
@@ -0,0 +1,163 @@
+//go:build !windows
+// +build !windows
+
+package seamless
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+// maxPassedListeners is the maximum number of listeners SendListeners and
+// RecvListeners can pass in a single call.
+const maxPassedListeners = 64
+
+// SendListeners sends the file descriptors of listeners over conn using
+// SCM_RIGHTS ancillary data, so the process on the other side can call
+// RecvListeners to get listeners bound to the exact same sockets. Listeners
+// must be *net.TCPListener or *net.UnixListener (or any listener with a File
+// method). The listeners are not closed and can still be used by the caller.
+func SendListeners(conn *net.UnixConn, listeners ...net.Listener) error {
+	if len(listeners) > maxPassedListeners {
+		return fmt.Errorf("cannot send more than %d listeners", maxPassedListeners)
+	}
+	files := make([]*os.File, 0, len(listeners))
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	fds := make([]int, 0, len(listeners))
+	for _, l := range listeners {
+		fl, ok := l.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("listener %T does not expose its file descriptor", l)
+		}
+		f, err := fl.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+		fds = append(fds, int(f.Fd()))
+	}
+	// The payload holds the number of listeners so the receiver can detect a
+	// truncated message. At least one byte of payload is required for the
+	// ancillary data to be sent.
+	payload := []byte(strconv.Itoa(len(fds)))
+	var oob []byte
+	if len(fds) > 0 {
+		oob = syscall.UnixRights(fds...)
+	}
+	n, oobn, err := conn.WriteMsgUnix(payload, oob, nil)
+	if err != nil {
+		return err
+	}
+	if n != len(payload) || oobn != len(oob) {
+		return errors.New("short write sending listeners")
+	}
+	return nil
+}
+
+// RecvListeners receives listeners sent with SendListeners over conn.
+func RecvListeners(conn *net.UnixConn) ([]net.Listener, error) {
+	payload := make([]byte, 16)
+	oob := make([]byte, syscall.CmsgSpace(maxPassedListeners*4))
+	n, oobn, flags, _, err := conn.ReadMsgUnix(payload, oob)
+	if err != nil {
+		return nil, err
+	}
+	// Collect received file descriptors first so they are not leaked on
+	// error.
+	fds, err := receivedFDs(oob[:oobn])
+	if err != nil {
+		return nil, err
+	}
+	if flags&syscall.MSG_CTRUNC != 0 {
+		closeFDs(fds)
+		return nil, errors.New("control message truncated")
+	}
+	count, err := strconv.Atoi(string(payload[:n]))
+	if err != nil {
+		closeFDs(fds)
+		return nil, fmt.Errorf("invalid payload %q", payload[:n])
+	}
+	if count != len(fds) {
+		closeFDs(fds)
+		return nil, fmt.Errorf("expected %d file descriptors, got %d", count, len(fds))
+	}
+	ls := make([]net.Listener, 0, len(fds))
+	for i, fd := range fds {
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("listener-%d", i))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range ls {
+				l.Close()
+			}
+			closeFDs(fds[i+1:])
+			return nil, fmt.Errorf("cannot create listener from fd %d: %v", fd, err)
+		}
+		ls = append(ls, l)
+	}
+	return ls, nil
+}
+
+// receivedFDs returns the file descriptors received in the oob control
+// messages. On error, the file descriptors already installed by the kernel are
+// closed.
+func receivedFDs(oob []byte) ([]int, error) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		closeReceivedRights(oob)
+		return nil, fmt.Errorf("cannot parse control message: %v", err)
+	}
+	var fds []int
+	for i := range msgs {
+		rights, err := syscall.ParseUnixRights(&msgs[i])
+		if err != nil {
+			closeReceivedRights(oob)
+			return nil, fmt.Errorf("cannot parse unix rights: %v", err)
+		}
+		fds = append(fds, rights...)
+	}
+	return fds, nil
+}
+
+// closeReceivedRights closes the file descriptors of the SCM_RIGHTS control
+// messages in oob which could not be parsed by
+// syscall.ParseSocketControlMessage. The messages are walked up to the first
+// malformed header, a truncated message giving the file descriptors it holds.
+func closeReceivedRights(oob []byte) {
+	hdrLen := syscall.CmsgLen(0)
+	for len(oob) >= hdrLen {
+		h := (*syscall.Cmsghdr)(unsafe.Pointer(&oob[0]))
+		l := int(h.Len)
+		if l < hdrLen {
+			return
+		}
+		if l > len(oob) {
+			l = len(oob)
+		}
+		if h.Level == syscall.SOL_SOCKET && h.Type == syscall.SCM_RIGHTS {
+			for data := oob[hdrLen:l]; len(data) >= 4; data = data[4:] {
+				syscall.Close(int(*(*int32)(unsafe.Pointer(&data[0]))))
+			}
+		}
+		next := syscall.CmsgSpace(l - hdrLen)
+		if next > len(oob) {
+			return
+		}
+		oob = oob[next:]
+	}
+}
+
+func closeFDs(fds []int) {
+	for _, fd := range fds {
+		syscall.Close(fd)
+	}
+}
@@ -0,0 +1,159 @@
+//go:build !windows
+// +build !windows
+
+package seamless
+
+import (
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// unixPair returns the two ends of a connected unix socket pair.
+func unixPair(t *testing.T) (*net.UnixConn, *net.UnixConn) {
+	t.Helper()
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := make([]*net.UnixConn, 2)
+	for i, fd := range fds {
+		f := os.NewFile(uintptr(fd), "socketpair")
+		c, err := net.FileConn(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns[i] = c.(*net.UnixConn)
+		t.Cleanup(func() { c.Close() })
+	}
+	return conns[0], conns[1]
+}
+
+// openFDs returns the number of open file descriptors of the process.
+func openFDs(t *testing.T) int {
+	t.Helper()
+	entries, err := os.ReadDir("/dev/fd")
+	if err != nil {
+		t.Skip(err)
+	}
+	return len(entries)
+}
+
+// sendRaw sends payload along with n duplicates of the file descriptor of l
+// over conn, bypassing the checks of SendListeners.
+func sendRaw(t *testing.T, conn *net.UnixConn, l net.Listener, payload string, n int) {
+	t.Helper()
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fds := make([]int, n)
+	for i := range fds {
+		fds[i] = int(f.Fd())
+	}
+	if _, _, err := conn.WriteMsgUnix([]byte(payload), syscall.UnixRights(fds...), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSendRecvListeners(t *testing.T) {
+	a, b := unixPair(t)
+	ls := []net.Listener{listen(t), listen(t)}
+	if err := SendListeners(a, ls...); err != nil {
+		t.Fatal(err)
+	}
+	got, err := RecvListeners(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(ls) {
+		t.Fatalf("received %d listeners, want %d", len(got), len(ls))
+	}
+	for i, l := range got {
+		defer l.Close()
+		if l.Addr().String() != ls[i].Addr().String() {
+			t.Errorf("listener %d bound to %s, want %s", i, l.Addr(), ls[i].Addr())
+		}
+	}
+	// The received listener accepts the connections of the sent socket.
+	conn, err := net.Dial("tcp", ls[0].Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c, err := got[0].Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+}
+
+func TestSendListenersTooMany(t *testing.T) {
+	a, _ := unixPair(t)
+	l := listen(t)
+	ls := make([]net.Listener, maxPassedListeners+1)
+	for i := range ls {
+		ls[i] = l
+	}
+	if err := SendListeners(a, ls...); err == nil {
+		t.Error("no error sending more than the maximum number of listeners")
+	}
+}
+
+func TestRecvListenersInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		n       int
+		want    string
+	}{
+		{"count mismatch", "2", 1, "expected 2 file descriptors, got 1"},
+		{"truncated", "65", maxPassedListeners + 1, "control message truncated"},
+		{"non numeric payload", "x", 1, "invalid payload"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := unixPair(t)
+			l := listen(t)
+			before := openFDs(t)
+			sendRaw(t, a, l, tt.payload, tt.n)
+			ls, err := RecvListeners(b)
+			if err == nil {
+				for _, l := range ls {
+					l.Close()
+				}
+				t.Fatal("no error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+			if after := openFDs(t); after != before {
+				t.Errorf("%d file descriptors leaked", after-before)
+			}
+		})
+	}
+}
+
+func TestReceivedFDsMalformed(t *testing.T) {
+	before := openFDs(t)
+	fd, err := syscall.Dup(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A valid SCM_RIGHTS message followed by a header shorter than its
+	// announced length.
+	oob := syscall.UnixRights(fd)
+	bad := make([]byte, syscall.CmsgLen(0))
+	copy(bad, syscall.UnixRights(fd))
+	oob = append(oob, bad...)
+	if _, err := receivedFDs(oob); err == nil {
+		t.Fatal("no error for a malformed control message")
+	}
+	if after := openFDs(t); after != before {
+		t.Errorf("%d file descriptors leaked", after-before)
+	}
+}
@@ -0,0 +1,18 @@
+package seamless
+
+import (
+	"errors"
+	"net"
+)
+
+var errFDPassingUnsupported = errors.New("seamless: file descriptor passing is not supported on windows")
+
+// SendListeners is not supported on Windows.
+func SendListeners(conn *net.UnixConn, listeners ...net.Listener) error {
+	return errFDPassingUnsupported
+}
+
+// RecvListeners is not supported on Windows.
+func RecvListeners(conn *net.UnixConn) ([]net.Listener, error) {
+	return nil, errFDPassingUnsupported
+}
@@ -0,0 +1,201 @@
+package seamless
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Generation states reported by Generations.
+const (
+	// GenerationLauncher is the launcher process of the current daemon.
+	GenerationLauncher = "launcher"
+	// GenerationStarting is a daemon which did not call Started yet.
+	GenerationStarting = "starting"
+	// GenerationServing is the daemon registered in the PID file.
+	GenerationServing = "serving"
+	// GenerationDraining is a previous daemon not exited yet.
+	GenerationDraining = "draining"
+)
+
+// GenerationInfo describes a process of the daemon's restart chain, as
+// returned by Generations.
+type GenerationInfo struct {
+	PID int
+	// StartedAt is the start time of the process, zero if unknown. It is only
+	// known for the current process and, if the PID file metadata is enabled
+	// (see SetPIDFileMetadata), for the one registered in the PID file.
+	StartedAt time.Time
+	// State is one of GenerationLauncher, GenerationStarting,
+	// GenerationServing or GenerationDraining.
+	State string
+}
+
+// trackPredecessors enables the generations file (see
+// EnablePredecessorTracking).
+var trackPredecessors bool
+
+// EnablePredecessorTracking makes Started notify all the previous generations
+// of the daemon not notified yet, instead of only the one found in the PID
+// file. This prevents a generation from lingering when restarts overlap, for
+// instance when a generation is replaced before the end of its overlap period
+// (see SetOverlap) or dies before notifying its predecessor.
+//
+// The generations waiting to be notified are tracked in a file next to the
+// PID file, with the ".generations" suffix, holding one PID per line in start
+// order. Dead processes are removed from it. When the control socket is used
+// (see UseControlSocket), only the predecessor listening on the socket is
+// notified.
+func EnablePredecessorTracking() {
+	if defaultController.inited {
+		panic("seamless.EnablePredecessorTracking must be called before seamless.Init")
+	}
+	trackPredecessors = true
+}
+
+// generationsPath returns the path of the generations file of c.
+func (c *Controller) generationsPath() string {
+	return c.pidFilePath + ".generations"
+}
+
+// addGeneration adds the current process to the generations file, dropping
+// the dead ones. The old process found in the PID file is added before it if
+// missing, like when tracking has just been enabled. It must be called with
+// the PID file lock held.
+func (c *Controller) addGeneration(old pidFileInfo, found bool) {
+	self := os.Getpid()
+	var gens []int
+	seen := false
+	for _, pid := range readGenerations(c.generationsPath()) {
+		if pid == old.PID {
+			seen = true
+		}
+		if pid != self && processAlive(pid) {
+			gens = append(gens, pid)
+		}
+	}
+	if found && !seen && old.PID != self {
+		gens = append(gens, old.PID)
+	}
+	gens = append(gens, self)
+	if err := writeGenerations(c.generationsPath(), gens); err != nil {
+		LogError("Could not write generations file", err)
+	}
+}
+
+// notifyPredecessors notifies the generations started before the current one
+// and removes them from the generations file. If the current process is no
+// longer in the file, a newer generation already notified its predecessors. It
+// must be called with the PID file lock held. old is the process found in the
+// PID file and listed the time the generations file was written before the
+// current process added itself, both used to verify the predecessors are not
+// unrelated processes which recycled the PID of a dead generation.
+func (c *Controller) notifyPredecessors(old pidFileInfo, listed time.Time) {
+	self := os.Getpid()
+	gens := readGenerations(c.generationsPath())
+	for i, pid := range gens {
+		if pid != self {
+			continue
+		}
+		if err := writeGenerations(c.generationsPath(), gens[i:]); err != nil {
+			LogError("Could not write generations file", err)
+		}
+		for _, pid := range gens[:i] {
+			if pid == old.PID {
+				c.notifyOld(old)
+				continue
+			}
+			c.notifyOld(pidFileInfo{PID: pid, Written: listed})
+		}
+		return
+	}
+}
+
+// readGenerations returns the PIDs listed in the generations file at path.
+func readGenerations(path string) []int {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			LogError("Could not read generations file", err)
+		}
+		return nil
+	}
+	var gens []int
+	for _, line := range strings.Split(string(b), "\n") {
+		if pid, err := strconv.Atoi(strings.TrimSpace(line)); err == nil && pid > 0 {
+			gens = append(gens, pid)
+		}
+	}
+	return gens
+}
+
+// writeGenerations atomically writes gens to the generations file at path.
+func writeGenerations(path string, gens []int) error {
+	var b strings.Builder
+	for _, pid := range gens {
+		b.WriteString(strconv.Itoa(pid))
+		b.WriteByte('\n')
+	}
+	return writeFileAtomic(path, b.String())
+}
+
+// Generations returns the processes of the daemon's restart chain known to
+// the current process: its launcher, the daemon registered in the PID file,
+// the previous generations still alive (requires EnablePredecessorTracking)
+// and itself. It is meant for observability, like a debug endpoint, and reads
+// the PID file and the generations file on each call. Nil is returned if
+// seamless is not enabled.
+func Generations() []GenerationInfo {
+	return defaultController.Generations()
+}
+
+// Generations is like the package level Generations function, operating on c.
+func (c *Controller) Generations() []GenerationInfo {
+	if !c.Enabled() {
+		return nil
+	}
+	var gens []GenerationInfo
+	if c.isDefault() && launcherPID != 0 && launcherAlive() {
+		gens = append(gens, GenerationInfo{PID: launcherPID, State: GenerationLauncher})
+	}
+	self := os.Getpid()
+	seen := map[int]bool{self: true}
+	serving := 0
+	if b, err := readPIDFile(c.pidFilePath); err == nil {
+		if info, err := parsePIDFile(b); err == nil && (info.PID == self || processAlive(info.PID)) {
+			serving = info.PID
+			if info.PID != self {
+				seen[info.PID] = true
+				gens = append(gens, GenerationInfo{PID: info.PID, StartedAt: info.Started, State: GenerationServing})
+			}
+		}
+	}
+	if trackPredecessors {
+		for _, pid := range readGenerations(c.generationsPath()) {
+			if !seen[pid] && processAlive(pid) {
+				seen[pid] = true
+				gens = append(gens, GenerationInfo{PID: pid, State: GenerationDraining})
+			}
+		}
+	}
+	state := GenerationDraining
+	switch {
+	case serving == self:
+		state = GenerationServing
+	case atomic.LoadInt32(&c.started) == 0:
+		state = GenerationStarting
+	}
+	return append(gens, GenerationInfo{PID: self, StartedAt: startTime, State: state})
+}
+
+// processAlive reports whether the process identified by pid exists.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
@@ -0,0 +1,46 @@
+//go:build !windows
+// +build !windows
+
+package seamless
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestPredecessorTracking(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	resetForTest(t)
+	EnablePredecessorTracking()
+	initTestDaemon(t, pidFile)
+	recordLogs(t)
+	sigs := recordSignals(t)
+	// The second generation replaced the first one, which was never
+	// notified, and a dead generation was left in the generations file.
+	first, second := startOldDaemon(t), startOldDaemon(t)
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	dead := cmd.Process.Pid
+	if err := writeGenerations(defaultController.generationsPath(), []int{dead, first, second}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(second)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	Started()
+	want := []sentSignal{{pid: first, sig: syscall.SIGTERM}, {pid: second, sig: syscall.SIGTERM}}
+	if got := sigs.signals(); !reflect.DeepEqual(got, want) {
+		t.Errorf("signals sent = %v, want %v", got, want)
+	}
+	if got, want := readGenerations(defaultController.generationsPath()), []int{os.Getpid()}; !reflect.DeepEqual(got, want) {
+		t.Errorf("generations = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+package seamless
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/seamless/internal/harness"
+)
+
+func init() {
+	harness.Init = initHarness
+	harness.Reset = reset
+	harness.ShutdownRequestSignal = sigShutdownRequest
+}
+
+// initHarness initializes seamless as a daemon started by the launcher, with
+// signals and launcher notification replaced by the given channels and
+// function.
+func initHarness(pidFile string, shutdownRequest, term chan os.Signal, parent func()) error {
+	c := defaultController
+	if c.inited {
+		return ErrAlreadyInitialized
+	}
+	c.inited = true
+	c.pidFilePath = pidFile
+	notifyParent = parent
+	notifyAbort = parent
+	notifyTerm = func() chan os.Signal {
+		return term
+	}
+	go c.stage1(shutdownRequest)
+	return nil
+}
+
+// Reset restores seamless to its uninitialized state, so Init (or one of its
+// variants) can be called again. It is meant for tests running the seamless
+// lifecycle several times in a single process, and must not be used otherwise:
+// the callbacks registered with the package functions and the settings made
+// with the Set* functions are forgotten, the control socket is closed, the
+// signal handlers installed by seamless are removed, and goroutines still
+// waiting on the previous lifecycle are abandoned. The exported variables
+// (LogMessage, LogError and ServeTimeout) are left untouched. Reset does not
+// stop a launcher, so tests should use InitNoLauncher or the seamlesstest
+// package.
+func Reset() {
+	signal.Reset(sigShutdownRequest, termSignal, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	if controlListener != nil {
+		controlListener.Close()
+	}
+	reset()
+}
+
+// reset resets seamless to its uninitialized state.
+func reset() {
+	defaultController = NewController()
+	forceDisabled = false
+	supervised = false
+	supervisorWarning = true
+	pidFileMode = 0644
+	pidFileUID = -1
+	pidFileGID = -1
+	pidFileMetadata = false
+	pidFileVersion = ""
+	launcherPID = 0
+	parentTermSignal = sigChild
+	termSignal = syscall.SIGTERM
+	stopSignal = nil
+	handoffTimeout = 10 * time.Second
+	termTimeout = 0
+	requestTimeout = 0
+	overlap = 0
+	shutdownTimeout = 0
+	drainProgress = nil
+	drainProgressEvery = 0
+	trackPredecessors = false
+	readinessPath = ""
+	procTitlePrefix = ""
+	readyFD = -1
+	systemdNotify = false
+	logger = stdLogger{}
+	launcherExitPolicy = ExitOnHandoff
+	controlPath = ""
+	controlCh = make(chan struct{}, 1)
+	controlListener = nil
+	hooksMu.Lock()
+	beforeForkFuncs = nil
+	onChildDaemonLaunch = nil
+	onChildLaunchFuncs = nil
+	onChildTimeoutFuncs = nil
+	onLauncherEventFuncs = nil
+	extraFiles = nil
+	launchCustomizer = nil
+	reloadFuncs = nil
+	reloadOnce = sync.Once{}
+	hooksMu.Unlock()
+	unixSocketsMu.Lock()
+	unixSockets = nil
+	unixSocketsMu.Unlock()
+	resetLauncher()
+	notifyParent = defaultNotifyParent
+	notifyAbort = defaultNotifyAbort
+	notifyTerm = defaultNotifyTerm
+}
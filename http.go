@@ -0,0 +1,61 @@
+package seamless
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// OnShutdownServer registers an OnShutdown callback gracefully shutting down
+// srv. If the graceful shutdown does not complete within timeout, or is
+// cancelled (see OnShutdownCtx), srv is forcibly closed.
+func OnShutdownServer(srv *http.Server, timeout time.Duration) {
+	OnShutdownCtx(func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			LogError("Graceful shutdown timeout, force closing", err)
+			MarkShutdownDegraded()
+			srv.Close()
+		}
+	})
+}
+
+// ServeTimeout is the maximum duration ServeHTTP gives in-flight requests to
+// complete during the graceful shutdown before the server is forcibly closed.
+var ServeTimeout = 60 * time.Second
+
+// ServeHTTP serves srv on l and handles the whole seamless restart sequence:
+// Started is called as soon as srv accepts connections on l, the graceful
+// shutdown of srv is registered as an OnShutdown callback (see
+// OnShutdownServer and ServeTimeout), and ServeHTTP blocks until the seamless
+// restart is completed.
+//
+// If srv fails to serve, the error is returned and Started is not called, so
+// the old process keeps serving.
+func ServeHTTP(srv *http.Server, l net.Listener) error {
+	OnShutdownServer(srv, ServeTimeout)
+	if err := srv.Serve(&startedListener{Listener: l}); err != http.ErrServerClosed {
+		return err
+	}
+	Wait()
+	return nil
+}
+
+// startedListener calls Started on the first call to Accept, i.e. once the
+// server is actually accepting connections.
+type startedListener struct {
+	net.Listener
+	once sync.Once
+}
+
+func (l *startedListener) Accept() (net.Conn, error) {
+	l.once.Do(func() {
+		// Started may block on the old process notification, the pending
+		// connections are queued by the kernel meanwhile.
+		go Started()
+	})
+	return l.Listener.Accept()
+}
@@ -0,0 +1,79 @@
+package seamless
+
+import (
+	"context"
+	"sync"
+)
+
+// InFlight tracks in-flight operations so a graceful shutdown can wait for
+// them to complete. It is like a sync.WaitGroup whose Wait method honors a
+// context. The zero value is ready to use.
+//
+//	var inflight seamless.InFlight
+//
+//	func handle(conn net.Conn) {
+//		inflight.Add(1)
+//		defer inflight.Done()
+//		...
+//	}
+//
+//	seamless.OnShutdown(func() {
+//		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+//		defer cancel()
+//		if err := inflight.Wait(ctx); err != nil {
+//			log.Printf("%d operations still in flight", inflight.Count())
+//		}
+//	})
+type InFlight struct {
+	mu    sync.Mutex
+	count int
+	idle  chan struct{} // closed when count reaches zero
+}
+
+// Add adds delta, which may be negative, to the number of in-flight
+// operations. Add panics if the counter goes negative.
+func (f *InFlight) Add(delta int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.count += delta
+	if f.count < 0 {
+		panic("seamless: negative InFlight counter")
+	}
+	if f.count == 0 && f.idle != nil {
+		close(f.idle)
+		f.idle = nil
+	}
+}
+
+// Done decrements the number of in-flight operations by one.
+func (f *InFlight) Done() {
+	f.Add(-1)
+}
+
+// Count returns the number of in-flight operations.
+func (f *InFlight) Count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.count
+}
+
+// Wait blocks until the number of in-flight operations drops to zero, or ctx
+// is done, in which case ctx.Err() is returned.
+func (f *InFlight) Wait(ctx context.Context) error {
+	f.mu.Lock()
+	if f.count == 0 {
+		f.mu.Unlock()
+		return nil
+	}
+	if f.idle == nil {
+		f.idle = make(chan struct{})
+	}
+	idle := f.idle
+	f.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,57 @@
+package seamless
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestInFlightWait(t *testing.T) {
+	var f InFlight
+	if err := f.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() with no operation = %v", err)
+	}
+	f.Add(2)
+	done := make(chan error, 1)
+	go func() {
+		done <- f.Wait(context.Background())
+	}()
+	f.Done()
+	select {
+	case err := <-done:
+		t.Fatalf("Wait() = %v with an operation in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	f.Done()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Wait() = %v", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Wait did not return once the operations completed")
+	}
+}
+
+func TestInFlightWaitTimeout(t *testing.T) {
+	var f InFlight
+	f.Add(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := f.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Wait() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if n := f.Count(); n != 1 {
+		t.Errorf("Count() = %d, want 1", n)
+	}
+}
+
+func TestInFlightNegative(t *testing.T) {
+	var f InFlight
+	defer func() {
+		if recover() == nil {
+			t.Error("Done with no operation in flight did not panic")
+		}
+	}()
+	f.Done()
+}
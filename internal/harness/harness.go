@@ -0,0 +1,19 @@
+// Package harness exposes seamless internals to the seamlesstest package. The
+// variables are set by the seamless package at initialization.
+package harness
+
+import "os"
+
+var (
+	// Init initializes seamless in daemon mode without launcher. Shutdown
+	// requests and TERM signals are read from shutdownRequest and term, and
+	// parent is called in place of signaling the launcher.
+	Init func(pidFile string, shutdownRequest, term chan os.Signal, parent func()) error
+
+	// Reset resets seamless to its uninitialized state.
+	Reset func()
+
+	// ShutdownRequestSignal is the signal sent by the launcher to request a
+	// shutdown.
+	ShutdownRequestSignal os.Signal
+)
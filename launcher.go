@@ -1,93 +1,611 @@
+//go:build !windows
+// +build !windows
+
 package seamless
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 )
 
+// launcherSupported reports whether the launcher, and thus seamless restart,
+// is supported on this platform.
+const launcherSupported = true
+
+const (
+	// sigShutdownRequest is sent by the launcher to the daemon to request a
+	// shutdown.
+	sigShutdownRequest = syscall.SIGUSR2
+	// sigChild is the default signal sent back by the daemon to the launcher
+	// once ready for the handoff.
+	sigChild = syscall.SIGCHLD
+)
+
+// forwardedSignals is the list of signals forwarded by the launcher to the
+// child process.
+var forwardedSignals = defaultForwardedSignals()
+
+// defaultForwardedSignals returns the signals forwarded by default, see
+// SetForwardedSignals.
+func defaultForwardedSignals() []os.Signal {
+	return []os.Signal{syscall.SIGABRT, syscall.SIGALRM, syscall.SIGBUS,
+		syscall.SIGCONT, syscall.SIGFPE, syscall.SIGHUP, syscall.SIGILL, syscall.SIGINT,
+		syscall.SIGIO, syscall.SIGIOT, syscall.SIGPROF, syscall.SIGQUIT,
+		syscall.SIGSEGV, syscall.SIGSYS, syscall.SIGTRAP, syscall.SIGTSTP,
+		syscall.SIGTTIN, syscall.SIGTTOU, syscall.SIGUSR1, syscall.SIGUSR2,
+		syscall.SIGVTALRM, syscall.SIGWINCH, syscall.SIGXCPU, syscall.SIGXFSZ}
+}
+
+// isForwarded reports whether sig is in the forwarded signals.
+func isForwarded(sig os.Signal) bool {
+	for _, s := range forwardedSignals {
+		if s == sig {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoredSignal reports whether sig is caught by the launcher only to be
+// dropped: a PIPE signal not explicitly forwarded is raised by a broken
+// launcher output and must neither kill the launcher nor reach the child.
+func ignoredSignal(sig os.Signal) bool {
+	return sig == syscall.SIGPIPE && !isForwarded(sig)
+}
+
+// SetForwardedSignals sets the list of signals the launcher forwards to the
+// daemon. The restart signals (see SetRestartSignal), the CHLD signal and the
+// signal set with SetParentTermSignal are always intercepted by the launcher
+// and can't be forwarded. When TERM is not a restart signal, the TERM signal
+// is always forwarded. Signals not in the list keep their default behavior in
+// the launcher.
+//
+// By default, all the other signals are forwarded except the benign ones:
+// URG, used by the Go runtime for goroutine preemption and thus received all
+// the time, and PIPE, which the launcher ignores.
+//
+// Seamless reserves USR2 for the restart handshake but never uses USR1, which
+// is thus a supported integration point for user-defined actions like log
+// rotation: when sent to the launcher, it is delivered as is to the daemon.
+func SetForwardedSignals(sigs ...os.Signal) {
+	if defaultController.inited {
+		panic("seamless.SetForwardedSignals must be called before seamless.Init")
+	}
+	forwardedSignals = sigs
+}
+
+// restartSignals are the signals triggering a seamless restart when received
+// by the launcher.
+var restartSignals = defaultRestartSignals()
+
+// defaultRestartSignals returns the restart signals used by default, see
+// SetRestartSignal.
+func defaultRestartSignals() []os.Signal {
+	return []os.Signal{syscall.SIGTERM, syscall.SIGINT}
+}
+
+// restartSignalsSet is true once SetRestartSignal has been called.
+var restartSignalsSet bool
+
+// SetRestartSignal sets the signals the launcher watches for to trigger a
+// seamless restart. By default, the TERM and INT signals trigger the restart,
+// so interrupting the launcher (e.g. with docker kill -s INT) produces the same
+// clean graceful shutdown as a supervisor stop. TERM is forwarded to the daemon
+// when not a restart signal, so it can be used to stop the daemon without
+// restart; to have INT forwarded to the daemon instead, call
+// SetRestartSignal(syscall.SIGTERM). The signal set with SetStopSignal takes
+// precedence over the restart signals.
+//
+// When the launcher runs in a terminal, no supervisor is there to start the
+// new daemon, so an INT restart signal (Ctrl-C) stops the service instead, as
+// if INT was the stop signal: the daemon engages its graceful shutdown with
+// ReasonStop and the launcher exits with the daemon's status.
+//
+// A restart signal received again while the launcher waits for the daemon to
+// detach escalates to a stop: the daemon is sent a TERM signal right away,
+// engaging its graceful shutdown without waiting for a new daemon, and the
+// launcher exits with the daemon's status. This lets an operator insisting on
+// stopping the service actually stop it.
+func SetRestartSignal(sigs ...os.Signal) {
+	if defaultController.inited {
+		panic("seamless.SetRestartSignal must be called before seamless.Init")
+	}
+	if len(sigs) == 0 {
+		panic("seamless.SetRestartSignal requires at least one signal")
+	}
+	restartSignals = sigs
+	restartSignalsSet = true
+}
+
+// isRestartSignal reports whether sig is one of the restart signals.
+func isRestartSignal(sig os.Signal) bool {
+	for _, s := range restartSignals {
+		if s == sig {
+			return true
+		}
+	}
+	return false
+}
+
+// stopOnInterrupt is true when the INT restart signal stops the service
+// because the launcher runs in a terminal, see SetRestartSignal.
+var stopOnInterrupt bool
+
+// detectInteractive sets stopOnInterrupt. The launcher and the daemon share
+// their standard input, so they agree on it.
+func detectInteractive() {
+	stopOnInterrupt = !supervised && stopSignal != syscall.SIGINT &&
+		isRestartSignal(syscall.SIGINT) && isTerminal(os.Stdin)
+}
+
+// isStopSignal reports whether sig stops the service instead of restarting it.
+func isStopSignal(sig os.Signal) bool {
+	return sig == stopSignal || (stopOnInterrupt && sig == syscall.SIGINT)
+}
+
+// restartTrigger returns the signal to send to the launcher to trigger a
+// restart: the first restart signal not stopping the service, nil if none.
+func restartTrigger() os.Signal {
+	for _, sig := range restartSignals {
+		if !isStopSignal(sig) {
+			return sig
+		}
+	}
+	return nil
+}
+
+// ignoreTerminalInterrupt ignores the INT signal in the daemon when the
+// launcher intercepts it. As the daemon shares the process group of the
+// launcher, it also receives the INT signal sent by the terminal on Ctrl-C,
+// which must not kill it before the launcher drives the graceful shutdown.
+func ignoreTerminalInterrupt() {
+	if supervised || isRestartSignal(syscall.SIGINT) || stopSignal == syscall.SIGINT {
+		signal.Ignore(syscall.SIGINT)
+	}
+}
+
+var (
+	childRestartAttempts int
+	childRestartBackoff  time.Duration
+	minChildLifetime     time.Duration
+)
+
+// SetChildRestartPolicy makes the launcher relaunch the child up to
+// maxAttempts times if it dies before a restart is requested, instead of
+// exiting. The launcher waits for backoff before the first relaunch, doubling
+// the delay on each subsequent attempt. Once the attempts are exhausted, the
+// launcher exits with a status matching the child's. By default, the child is
+// never relaunched.
+//
+// The same policy applies to transient failures (EAGAIN, ENOMEM) to start the
+// child process, which are retried before the launcher gives up.
+func SetChildRestartPolicy(maxAttempts int, backoff time.Duration) {
+	if defaultController.inited {
+		panic("seamless.SetChildRestartPolicy must be called before seamless.Init")
+	}
+	childRestartAttempts = maxAttempts
+	childRestartBackoff = backoff
+}
+
+// SetMinChildLifetime makes the launcher exit with a non-zero status (1) if the
+// child exits successfully less than d after being started, before any
+// restart is requested. A daemon is not expected to exit by itself, and one
+// exiting right away with a zero status (printing its version or usage for
+// instance) would otherwise make the supervisor consider the service as
+// cleanly stopped. The restart policy (see SetChildRestartPolicy) still
+// applies before the launcher exits. A zero duration, the default, disables
+// the check.
+func SetMinChildLifetime(d time.Duration) {
+	if defaultController.inited {
+		panic("seamless.SetMinChildLifetime must be called before seamless.Init")
+	}
+	minChildLifetime = d
+}
+
+// resetLauncher resets the launcher settings, see Reset.
+func resetLauncher() {
+	forwardedSignals = defaultForwardedSignals()
+	restartSignals = defaultRestartSignals()
+	restartSignalsSet = false
+	stopOnInterrupt = false
+	childRestartAttempts = 0
+	childRestartBackoff = 0
+	minChildLifetime = 0
+	execLauncher = false
+	execLauncherCtx = nil
+	execCustomizer = nil
+	launcherAck = nil
+	hooksMu.Lock()
+	sharedListeners = nil
+	hooksMu.Unlock()
+}
+
 // launch forks the current program with the same arguments and exit the main go
 // routine to prevent the current process from executing its main logic.
 //
 // All signals received on the parent process (the launcher) are forwarded to
 // this child process except for the TERM signal. When a TERM signal is received
 // on the parent, an USR2 signal is sent to the child. At this point, the child
-// is given 10 seconds to prepare to welcome a new version of the daemon in
-// parallel and send back a CHLD signal. Once the CHLD signal is received, the
-// launcher exit, detaching the child from the supervisor. This way the
-// supervisor can immediately restart the program while the older child can
-// gracefully shutdown.
+// is given the handoff timeout (10 seconds by default) to prepare to welcome a
+// new version of the daemon in parallel and send back a CHLD signal. Once the
+// CHLD signal is received, the launcher exit, detaching the child from the
+// supervisor. This way the supervisor can immediately restart the program
+// while the older child can gracefully shutdown.
+//
+// If the child does not send a SIGCHLD signal back within the handoff timeout,
+// the launcher sends it a TERM signal and exits once the child exited.
 //
-// If the child does not send a SIGCHLD signal back within 10 seconds, the
-// launcher sends a TERM signal before dying.
+// If the child dies before a restart is requested, it is relaunched according
+// to the policy set with SetChildRestartPolicy. Otherwise the launcher exits
+// with a status matching the child's.
 func launch() {
-	cmd, err := os.Executable()
+	setProcTitle("launcher")
+	code := runLauncher(nil)
+	removeLauncherNonce(defaultController.pidFilePath)
+	fireLauncherEvent(LauncherExiting)
+	os.Exit(code)
+}
+
+// runLauncher starts the child process and supervises it until the launcher
+// must exit, and returns the exit code of the launcher. The launcher signal
+// handling is stopped on return. Closing stop makes runLauncher return -1, so
+// the launcher state machine can be run in-process.
+func runLauncher(stop <-chan struct{}) int {
+	ackR, ackW, acks, err := newAckPipe()
+	if err != nil {
+		LogError("Could not create the handoff pipe", err)
+		return 1
+	}
+	defer ackR.Close()
+	defer ackW.Close()
+	cmd, argv, attrs, err := childCommand(ackW)
 	if err != nil {
 		LogError("Could not determin executable path", err)
-		os.Exit(1)
+		return 1
+	}
+	p, err := startChild(cmd, argv, attrs)
+	if err != nil {
+		return 1
+	}
+	childStartedAt := clk.Now()
+
+	c := make(chan os.Signal, 10)
+	signal.Notify(c, append(forwardedSignals, syscall.SIGTERM, syscall.SIGCHLD, syscall.SIGPIPE, parentTermSignal, sigShutdownRequest)...)
+	signal.Notify(c, restartSignals...)
+	if stopSignal != nil {
+		signal.Notify(c, stopSignal)
+	}
+	defer signal.Stop(c)
+	terminated := false
+	stopping := false
+	attempts := 0
+	// childExited relaunches the child if allowed by the restart policy.
+	// Otherwise, it returns true with the exit code of the launcher, matching
+	// the child's.
+	childExited := func(ws syscall.WaitStatus) (code int, exit bool) {
+		if terminated || stopping {
+			return exitCode(ws), true
+		}
+		if attempts >= childRestartAttempts {
+			code = exitCode(ws)
+			if lifetime := clk.Now().Sub(childStartedAt); code == 0 && lifetime < minChildLifetime {
+				LogMessage(fmt.Sprintf("Child exited successfully after only %s, reporting a failure", lifetime))
+				code = 1
+			}
+			return code, true
+		}
+		backoff := childRestartBackoff << uint(attempts)
+		attempts++
+		LogError(fmt.Sprintf("Child died unexpectedly, relaunching in %s", backoff), waitStatusError(ws))
+		<-clk.After(backoff)
+		if p, err = startChild(cmd, argv, attrs); err != nil {
+			return 1, true
+		}
+		childStartedAt = clk.Now()
+		return 0, false
+	}
+	// The child may have died before the signal handler was installed, in
+	// which case its SIGCHLD was lost.
+	if ws, changed := waitChild(p.Pid); changed && (ws.Exited() || ws.Signaled()) {
+		if code, exit := childExited(ws); exit {
+			return code
+		}
+	}
+	// The handoff timer is armed once a restart is requested. Until then,
+	// handoffTimeoutC is nil and its select case never fires.
+	var handoffTimeoutC <-chan time.Time
+	// With the WaitForNewBound exit policy, the PID file is polled once the
+	// daemon is ready, until a new generation is bound or the handoff timeout
+	// elapsed.
+	var boundPollC, boundTimeoutC <-chan time.Time
+	// acknowledged handles the handoff acknowledgment of the child. It
+	// returns true with the exit code of the launcher if the launcher must
+	// exit.
+	acknowledged := func() (code int, exit bool) {
+		if !terminated || stopping {
+			return 0, false
+		}
+		if boundTimeoutC == nil {
+			fireLauncherEvent(LauncherHandoffAcknowledged)
+		}
+		defaultController.setState(StateReady)
+		if launcherExitPolicy != WaitForNewBound {
+			return 0, true
+		}
+		if boundTimeoutC == nil {
+			LogMessage("Waiting for the new process to start")
+			handoffTimeoutC = nil
+			boundPollC = clk.After(boundPollInterval)
+			boundTimeoutC = clk.After(handoffTimeout)
+		}
+		return 0, false
+	}
+	for {
+		var sig os.Signal
+		select {
+		case sig = <-c:
+		case <-stop:
+			return -1
+		case <-acks:
+			if code, exit := acknowledged(); exit {
+				return code
+			}
+			continue
+		case <-boundPollC:
+			if newGenerationBound(p.Pid) {
+				LogMessage("New process started, exiting")
+				return 0
+			}
+			boundPollC = clk.After(boundPollInterval)
+			continue
+		case <-boundTimeoutC:
+			LogMessage("No new process started within the handoff timeout, exiting")
+			return 0
+		case <-handoffTimeoutC:
+			handoffTimeoutC = nil
+			LogMessage("Child timeout, terminating")
+			for _, f := range onChildTimeoutFuncs {
+				f()
+			}
+			fireLauncherEvent(LauncherChildTimeout)
+			if err := p.Signal(termSignal); err != nil {
+				LogError(fmt.Sprintf("Error sending %s signal", termSignal), err)
+			}
+			continue
+		}
+		switch {
+		case isStopSignal(sig):
+			if terminated || stopping {
+				continue
+			}
+			stopping = true
+			LogMessage("Stop requested")
+			if err := p.Signal(syscall.SIGTERM); err != nil {
+				LogError("Could not send TERM signal", err)
+			}
+		case isRestartSignal(sig):
+			if stopping {
+				continue
+			}
+			if terminated {
+				// Restart signal repeated during the handoff window:
+				// escalate to a stop.
+				stopping = true
+				handoffTimeoutC = nil
+				LogMessage(fmt.Sprintf("%s signal received during restart, terminating child", sig))
+				if err := p.Signal(termSignal); err != nil {
+					LogError(fmt.Sprintf("Could not send %s signal", termSignal), err)
+				}
+				continue
+			}
+			defaultController.setState(StateRequested)
+			if err := sendCriticalSignal(p, syscall.SIGUSR2); err != nil {
+				LogError("Could not send USR2 signal", err)
+				defaultController.updateMetrics(func(m *Metrics) { m.SignalFailures++ })
+			}
+			fireLauncherEvent(LauncherRestartSignalled)
+			terminated = true
+			// Arm the timer after which the child is sent a SIGTERM if
+			// no SIGCHLD has been recieved.
+			handoffTimeoutC = clk.After(handoffTimeout)
+		case sig == sigShutdownRequest:
+			if terminated && !stopping {
+				// The child aborted the restart (see AbortRestart), cancel
+				// the handoff.
+				terminated = false
+				handoffTimeoutC = nil
+				boundPollC, boundTimeoutC = nil, nil
+				LogMessage("Restart aborted by child")
+				defaultController.setState(StateRunning)
+				continue
+			}
+			if err := p.Signal(sig); err != nil {
+				LogError(fmt.Sprintf("Error forwarding %s signal", sig), err)
+			}
+		case sig == parentTermSignal || sig == syscall.SIGCHLD:
+			// Check if the child actually died, in which case we exit with
+			// a matching status so the supervisor can tell a crash from a
+			// clean handoff.
+			ws, changed := waitChild(p.Pid)
+			if changed && (ws.Exited() || ws.Signaled()) {
+				if code, exit := childExited(ws); exit {
+					return code
+				}
+				continue
+			}
+			if changed && sig == syscall.SIGCHLD {
+				// This CHLD has been generated by the kernel because the
+				// child was stopped or continued, it is not the handoff
+				// signal sent by the daemon.
+				continue
+			}
+			// The handoff is acknowledged through the handoff pipe, the CHLD
+			// signal alone is ambiguous as any child of the launcher
+			// generates one. A distinct parent term signal is trusted as is.
+			if sig == parentTermSignal && sig != syscall.SIGCHLD {
+				if code, exit := acknowledged(); exit {
+					return code
+				}
+			}
+		case ignoredSignal(sig):
+		default:
+			if err := p.Signal(sig); err != nil {
+				LogError(fmt.Sprintf("Error forwarding %s signal", sig), err)
+			}
+		}
+	}
+}
+
+// osExecutable returns the path of the current executable. It is a variable
+// so it can be replaced in tests.
+var osExecutable = os.Executable
+
+// executable returns the path of the executable to launch as the child. If
+// the current executable can't be resolved, os.Args[0] is looked up in the
+// PATH instead.
+func executable() (string, error) {
+	cmd, err := osExecutable()
+	if err == nil {
+		return cmd, nil
+	}
+	LogError("Could not determin executable path, falling back to os.Args[0]", err)
+	cmd, lerr := exec.LookPath(os.Args[0])
+	if lerr != nil {
+		return "", fmt.Errorf("%v, fallback: %v", err, lerr)
+	}
+	LogMessage("Using executable " + cmd)
+	return cmd, nil
+}
+
+// childCommand returns the executable, arguments and process attributes used
+// by the launcher to start the child process. The ack file, the write end of
+// the handoff pipe, is passed to the child.
+func childCommand(ack *os.File) (cmd string, argv []string, attrs *os.ProcAttr, err error) {
+	cmd, err = executable()
+	if err != nil {
+		return "", nil, nil, err
 	}
-	argv := os.Args
-	attrs := &os.ProcAttr{
-		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+	argv = os.Args
+	attrs = &os.ProcAttr{
+		// Forward socket activation file descriptors if any (see
+		// InheritListeners).
+		Files: append([]*os.File{os.Stdin, os.Stdout, os.Stderr}, activationFiles()...),
+	}
+	attrs.Files = append(attrs.Files, extraFiles...)
+	if fd := readyFDNumber(); fd >= 0 {
+		// Pass the readiness file descriptor on to the daemon, which finds
+		// its new number in the environment.
+		os.Setenv("SEAMLESS_READY_FD", strconv.Itoa(len(attrs.Files)))
+		attrs.Files = append(attrs.Files, os.NewFile(uintptr(fd), "ready"))
+	}
+	os.Setenv(ackFDEnv, strconv.Itoa(len(attrs.Files)))
+	attrs.Files = append(attrs.Files, ack)
+	if launchCustomizer != nil {
+		origArgv, origAttrs := argv, attrs
+		argv, attrs = launchCustomizer(attrs, argv)
+		if argv == nil {
+			argv = origArgv
+		}
+		if attrs == nil {
+			attrs = origAttrs
+		}
+		if attrs.Env != nil {
+			// Make sure the child still recognizes its launcher.
+			attrs.Env = setEnv(attrs.Env, "SEAMLESS", strconv.Itoa(os.Getpid()))
+			attrs.Env = setEnv(attrs.Env, "SEAMLESS_NONCE", os.Getenv("SEAMLESS_NONCE"))
+			attrs.Env = setEnv(attrs.Env, ackFDEnv, os.Getenv(ackFDEnv))
+		}
+	}
+	return cmd, argv, attrs, nil
+}
+
+// startProcess starts a process. It is a variable so it can be replaced in
+// tests.
+var startProcess = os.StartProcess
+
+// isTransient reports whether err is due to a temporary lack of resources.
+func isTransient(err error) bool {
+	return errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.ENOMEM)
+}
+
+// startChild starts the child process and executes the launcher hooks.
+func startChild(cmd string, argv []string, attrs *os.ProcAttr) (*os.Process, error) {
+	for _, f := range beforeForkFuncs {
+		f()
+	}
+	p, err := startChildProcess(cmd, argv, attrs)
+	// Retry on transient failures according to the child restart policy.
+	for attempt := 0; err != nil && isTransient(err) && attempt < childRestartAttempts; attempt++ {
+		backoff := childRestartBackoff << uint(attempt)
+		LogError(fmt.Sprintf("Could not fork, retrying in %s", backoff), err)
+		<-clk.After(backoff)
+		p, err = startChildProcess(cmd, argv, attrs)
 	}
-	p, err := os.StartProcess(cmd, argv, attrs)
 	if err != nil {
 		LogError("Could not fork", err)
-		os.Exit(1)
+		return nil, err
 	}
 
 	// Execute callbacks post the daemon launch before starting signal handler
 	for _, f := range onChildDaemonLaunch {
 		f()
 	}
+	for _, f := range onChildLaunchFuncs {
+		f(p.Pid)
+	}
+	fireLauncherEvent(LauncherChildForked)
+	return p, nil
+}
 
-	c := make(chan os.Signal, 10)
-	signal.Notify(c, syscall.SIGABRT, syscall.SIGALRM, syscall.SIGBUS, syscall.SIGCHLD,
-		syscall.SIGCONT, syscall.SIGFPE, syscall.SIGHUP, syscall.SIGILL, syscall.SIGINT,
-		syscall.SIGIO, syscall.SIGIOT, syscall.SIGPIPE, syscall.SIGPROF, syscall.SIGQUIT,
-		syscall.SIGSEGV, syscall.SIGSYS, syscall.SIGTERM, syscall.SIGTRAP, syscall.SIGTSTP,
-		syscall.SIGTTIN, syscall.SIGTTOU, syscall.SIGURG, syscall.SIGUSR1, syscall.SIGUSR2,
-		syscall.SIGVTALRM, syscall.SIGWINCH, syscall.SIGXCPU, syscall.SIGXFSZ)
-	go func() {
-		terminated := false
-		timer := make(<-chan time.Time) // never firing timer
-		for {
-			var sig os.Signal
-			select {
-			case sig = <-c:
-			case <-timer:
-				LogError("Child timeout, terminating", nil)
-				if err := p.Signal(syscall.SIGTERM); err != nil {
-					LogError("Error sending TERM signal", err)
-				}
-			}
-			switch sig {
-			case syscall.SIGTERM:
-				if terminated {
-					continue
-				}
-				if err := p.Signal(syscall.SIGUSR2); err != nil {
-					LogError("Could not send USR2 signal", err)
-				}
-				terminated = true
-				// Setup a timer after which the child is sent a SIGTERM if
-				// no SIGCHLD has been recieved.
-				timer = time.After(10 * time.Second)
-			case parentTermSignal:
-				fallthrough
-			case syscall.SIGCHLD:
-				if terminated {
-					os.Exit(0)
-				}
-			default:
-				if err := p.Signal(sig); err != nil {
-					LogError(fmt.Sprintf("Error forwarding %s signal", sig), err)
-				}
-			}
+// setEnv returns env with key set to value, replacing any existing definition.
+func setEnv(env []string, key, value string) []string {
+	res := make([]string, 0, len(env)+1)
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, key+"=") {
+			res = append(res, kv)
 		}
-	}()
-	p.Wait()
-	os.Exit(0)
+	}
+	return append(res, key+"="+value)
+}
+
+// waitChild collects the state change of the child identified by pid without
+// blocking. It returns the wait status of the child and true if the child has
+// exited, was stopped or was continued since the last call.
+func waitChild(pid int) (syscall.WaitStatus, bool) {
+	var ws syscall.WaitStatus
+	wpid, err := syscall.Wait4(pid, &ws, syscall.WNOHANG|syscall.WUNTRACED|waitContinued, nil)
+	if err != nil || wpid != pid {
+		return ws, false
+	}
+	return ws, true
+}
+
+// exitCode returns the launcher exit code matching the child wait status.
+func exitCode(ws syscall.WaitStatus) int {
+	if err := waitStatusError(ws); err != nil {
+		LogError("Child exited", err)
+	}
+	if ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ws.ExitStatus()
+}
+
+// waitStatusError returns an error describing ws, or nil if the child exited
+// successfully.
+func waitStatusError(ws syscall.WaitStatus) error {
+	if ws.Signaled() {
+		return fmt.Errorf("signal: %s", ws.Signal())
+	}
+	if code := ws.ExitStatus(); code != 0 {
+		return fmt.Errorf("exit status %d", code)
+	}
+	return nil
 }
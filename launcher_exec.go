@@ -0,0 +1,82 @@
+//go:build !windows
+// +build !windows
+
+package seamless
+
+import (
+	"context"
+	"os"
+	"os/exec"
+)
+
+var (
+	// execLauncher is true when the launcher starts the child with exec.Cmd
+	// (see SetExecLauncher).
+	execLauncher    bool
+	execLauncherCtx context.Context
+	execCustomizer  func(cmd *exec.Cmd)
+)
+
+// SetExecLauncher makes the launcher start the child process with an
+// exec.Cmd created with exec.CommandContext(ctx, ...) instead of
+// os.StartProcess. The command gets the arguments, environment and files the
+// launcher would pass to os.StartProcess (see SetExtraFiles and
+// SetLaunchCustomizer), then configure, if not nil, is called to adjust it
+// before it is started. For instance, to start the child in its own process
+// group so signals sent to the launcher's group do not reach it:
+//
+//	seamless.SetExecLauncher(context.Background(), func(cmd *exec.Cmd) {
+//		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+//	})
+//
+// Cancelling ctx kills the child, as with exec.CommandContext. A nil ctx is
+// taken as context.Background(). The launcher reaps the child itself:
+// configure must not start it nor keep it to call Wait. The same
+// configuration applies when the child is relaunched (see
+// SetChildRestartPolicy). By default, os.StartProcess is used.
+func SetExecLauncher(ctx context.Context, configure func(cmd *exec.Cmd)) {
+	if defaultController.inited {
+		panic("seamless.SetExecLauncher must be called before seamless.Init")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	execLauncher = true
+	execLauncherCtx = ctx
+	execCustomizer = configure
+}
+
+// startChildProcess starts the child process with os.StartProcess, or with
+// exec.Cmd if configured with SetExecLauncher.
+func startChildProcess(name string, argv []string, attrs *os.ProcAttr) (*os.Process, error) {
+	if !execLauncher {
+		return startProcess(name, argv, attrs)
+	}
+	cmd := exec.CommandContext(execLauncherCtx, name)
+	cmd.Args = argv
+	cmd.Env = attrs.Env
+	cmd.Dir = attrs.Dir
+	cmd.SysProcAttr = attrs.Sys
+	// Assign only non nil files, a nil *os.File in an io.Reader or io.Writer
+	// field is not a nil interface.
+	for i, f := range attrs.Files {
+		switch {
+		case f == nil && i < 3:
+		case i == 0:
+			cmd.Stdin = f
+		case i == 1:
+			cmd.Stdout = f
+		case i == 2:
+			cmd.Stderr = f
+		default:
+			cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+		}
+	}
+	if execCustomizer != nil {
+		execCustomizer(cmd)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd.Process, nil
+}
@@ -0,0 +1,705 @@
+//go:build !windows
+// +build !windows
+
+package seamless
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const (
+	// testRoleEnv makes the test binary run as the child of the launcher
+	// tests, with the given role, instead of running the tests.
+	testRoleEnv = "SEAMLESS_TEST_ROLE"
+	// testDirEnv is the directory holding the PID file and the events file
+	// of the launcher tests.
+	testDirEnv = "SEAMLESS_TEST_DIR"
+)
+
+func TestMain(m *testing.M) {
+	if role := os.Getenv(testRoleEnv); role != "" {
+		runTestChild(role, os.Getenv(testDirEnv))
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// runTestChild runs the child started by a test launcher, reporting what
+// happens to it as events (see testEvent).
+func runTestChild(role, dir string) {
+	// Don't behave differently when the tests run in a terminal.
+	os.Stdin, _ = os.Open(os.DevNull)
+	switch role {
+	case "daemon", "spurious-chld":
+		Init(filepath.Join(dir, "app.pid"))
+		// Watched after Init, which ignores INT as a restart signal with
+		// the default settings: the child does not share the settings of
+		// the test launcher.
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGUSR1, syscall.SIGWINCH, syscall.SIGINT)
+		go func() {
+			for sig := range sigs {
+				testEvent(dir, "signal "+sig.String())
+			}
+		}()
+		OnShutdownRequest(func() { testEvent(dir, "request") })
+		OnShutdown(func() { testEvent(dir, "shutdown") })
+		if role == "spurious-chld" {
+			// A CHLD not acknowledging the handoff, like the one of an
+			// unrelated child of the launcher.
+			OnShutdownRequest(func() {
+				syscall.Kill(os.Getppid(), syscall.SIGCHLD)
+				testEvent(dir, "spurious chld")
+				time.Sleep(500 * time.Millisecond)
+			})
+		}
+		Started()
+		testEvent(dir, "started")
+		Wait()
+		testEvent(dir, "exit")
+	case "no-ack":
+		// A child not using seamless, never acknowledging the handoff.
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGUSR2, syscall.SIGTERM)
+		testEvent(dir, "ready")
+		for sig := range sigs {
+			if sig == syscall.SIGTERM {
+				testEvent(dir, "term")
+				break
+			}
+			testEvent(dir, "usr2")
+		}
+	case "extra-file":
+		// The first extra file, see SetExtraFiles.
+		line, err := bufio.NewReader(os.NewFile(3, "extra")).ReadString('\n')
+		if err != nil {
+			testEvent(dir, "extra error "+err.Error())
+			os.Exit(1)
+		}
+		testEvent(dir, "extra "+strings.TrimSpace(line))
+	case "exit":
+		// A child exiting successfully right away, like one printing its
+		// version.
+	case "pgrp":
+		// Whether the child leads its own process group, see
+		// SetExecLauncher.
+		if syscall.Getpgrp() == os.Getpid() {
+			testEvent(dir, "pgrp leader")
+		} else {
+			testEvent(dir, "pgrp inherited")
+		}
+	}
+	os.Exit(0)
+}
+
+// testEvent appends event to the events file in dir.
+func testEvent(dir, event string) {
+	f, err := os.OpenFile(filepath.Join(dir, "events"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(event + "\n"); err != nil {
+		panic(err)
+	}
+}
+
+// testLauncher runs the launcher state machine in the test process, the test
+// binary being started as the child with a test role (see runTestChild).
+type testLauncher struct {
+	dir      string
+	stop     chan struct{}
+	stopOnce sync.Once
+	code     chan int
+	done     chan struct{}
+
+	mu   sync.Mutex
+	pids []int
+}
+
+// startTestLauncher starts a launcher starting the child with role. Seamless
+// must have been reset and configured by the caller. The launcher is stopped
+// and its children killed once the test completes.
+func startTestLauncher(t *testing.T, role string) *testLauncher {
+	t.Helper()
+	l := &testLauncher{
+		dir:  t.TempDir(),
+		stop: make(chan struct{}),
+		code: make(chan int, 1),
+		done: make(chan struct{}),
+	}
+	pidFile := filepath.Join(l.dir, "app.pid")
+	defaultController.pidFilePath = pidFile
+	t.Setenv(testRoleEnv, role)
+	t.Setenv(testDirEnv, l.dir)
+	t.Setenv("SEAMLESS", strconv.Itoa(os.Getpid()))
+	// Set by the launcher, restored once the test completes.
+	t.Setenv("SEAMLESS_NONCE", "")
+	t.Setenv(ackFDEnv, "")
+	if err := writeLauncherNonce(pidFile); err != nil {
+		t.Fatal(err)
+	}
+	OnChildLaunch(func(pid int) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.pids = append(l.pids, pid)
+	})
+	go func() {
+		defer close(l.done)
+		l.code <- runLauncher(l.stop)
+	}()
+	t.Cleanup(l.close)
+	return l
+}
+
+// halt makes the launcher return, leaving its child running.
+func (l *testLauncher) halt() {
+	l.stopOnce.Do(func() { close(l.stop) })
+}
+
+// close stops the launcher and kills its children.
+func (l *testLauncher) close() {
+	l.halt()
+	<-l.done
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, pid := range l.pids {
+		syscall.Kill(pid, syscall.SIGKILL)
+		var ws syscall.WaitStatus
+		syscall.Wait4(pid, &ws, 0, nil)
+	}
+}
+
+// childPID returns the PID of the last child started by the launcher.
+func (l *testLauncher) childPID(t *testing.T) int {
+	t.Helper()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.pids) == 0 {
+		t.Fatal("no child started")
+	}
+	return l.pids[len(l.pids)-1]
+}
+
+// signal sends sig to the launcher.
+func (l *testLauncher) signal(t *testing.T, sig syscall.Signal) {
+	t.Helper()
+	if err := syscall.Kill(os.Getpid(), sig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// wait returns the exit code of the launcher.
+func (l *testLauncher) wait(t *testing.T) int {
+	t.Helper()
+	select {
+	case code := <-l.code:
+		return code
+	case <-time.After(testTimeout):
+		t.Fatal("launcher did not exit")
+		return 0
+	}
+}
+
+// running reports whether the launcher is still running after d.
+func (l *testLauncher) running(d time.Duration) bool {
+	select {
+	case <-l.done:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// hasEvent reports whether the child reported event.
+func (l *testLauncher) hasEvent(event string) bool {
+	b, _ := os.ReadFile(filepath.Join(l.dir, "events"))
+	for _, e := range strings.Split(string(b), "\n") {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// waitEvent waits for the child to report event.
+func (l *testLauncher) waitEvent(t *testing.T, event string) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for !l.hasEvent(event) {
+		if time.Now().After(deadline) {
+			b, _ := os.ReadFile(filepath.Join(l.dir, "events"))
+			t.Fatalf("event %q not reported, got:\n%s", event, b)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestForwardedSignals(t *testing.T) {
+	resetForTest(t)
+	recordLogs(t)
+	SetForwardedSignals(syscall.SIGUSR1)
+	l := startTestLauncher(t, "daemon")
+	l.waitEvent(t, "started")
+	l.signal(t, syscall.SIGWINCH)
+	l.signal(t, syscall.SIGUSR1)
+	l.waitEvent(t, "signal "+syscall.SIGUSR1.String())
+	time.Sleep(50 * time.Millisecond)
+	if l.hasEvent("signal " + syscall.SIGWINCH.String()) {
+		t.Error("signal not in the forwarded signals forwarded to the child")
+	}
+}
+
+func TestLauncherIgnoresSpuriousChild(t *testing.T) {
+	resetForTest(t)
+	recordLogs(t)
+	l := startTestLauncher(t, "spurious-chld")
+	l.waitEvent(t, "started")
+	l.signal(t, syscall.SIGTERM)
+	l.waitEvent(t, "spurious chld")
+	if !l.running(200 * time.Millisecond) {
+		t.Fatal("launcher exited on a spurious CHLD")
+	}
+	if code := l.wait(t); code != 0 {
+		t.Errorf("launcher exit code = %d, want 0", code)
+	}
+	if !l.hasEvent("request") {
+		t.Error("OnShutdownRequest callback not called")
+	}
+}
+
+func TestExtraFiles(t *testing.T) {
+	resetForTest(t)
+	recordLogs(t)
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	SetExtraFiles(r)
+	l := startTestLauncher(t, "extra-file")
+	if _, err := w.WriteString("hello\n"); err != nil {
+		t.Fatal(err)
+	}
+	l.waitEvent(t, "extra hello")
+	if code := l.wait(t); code != 0 {
+		t.Errorf("launcher exit code = %d, want 0", code)
+	}
+}
+
+func TestExecLauncherSetpgid(t *testing.T) {
+	tests := []struct {
+		name    string
+		setpgid bool
+		want    string
+	}{
+		{"default", false, "pgrp inherited"},
+		{"setpgid", true, "pgrp leader"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetForTest(t)
+			recordLogs(t)
+			if tt.setpgid {
+				SetExecLauncher(context.Background(), func(cmd *exec.Cmd) {
+					cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+				})
+			}
+			l := startTestLauncher(t, "pgrp")
+			l.waitEvent(t, tt.want)
+			if code := l.wait(t); code != 0 {
+				t.Errorf("launcher exit code = %d, want 0", code)
+			}
+		})
+	}
+}
+
+func TestMinChildLifetime(t *testing.T) {
+	tests := []struct {
+		name     string
+		lifetime time.Duration
+		want     int
+	}{
+		{"disabled", 0, 0},
+		{"immediate exit", time.Minute, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetForTest(t)
+			logs := recordLogs(t)
+			SetMinChildLifetime(tt.lifetime)
+			l := startTestLauncher(t, "exit")
+			if code := l.wait(t); code != tt.want {
+				t.Errorf("launcher exit code = %d, want %d", code, tt.want)
+			}
+			if reported := logs.contains("reporting a failure"); reported != (tt.want != 0) {
+				t.Errorf("failure reported: %v", reported)
+			}
+		})
+	}
+}
+
+func TestHandoffTimeout(t *testing.T) {
+	resetForTest(t)
+	recordLogs(t)
+	const timeout = 100 * time.Millisecond
+	SetHandoffTimeout(timeout)
+	timedOut := make(chan struct{}, 1)
+	OnChildTimeout(func() { timedOut <- struct{}{} })
+	l := startTestLauncher(t, "no-ack")
+	l.waitEvent(t, "ready")
+
+	// The handoff timer is not armed before a restart is requested.
+	time.Sleep(3 * timeout)
+	select {
+	case <-timedOut:
+		t.Fatal("handoff timeout fired before the restart request")
+	default:
+	}
+	if l.hasEvent("term") {
+		t.Fatal("child terminated before the restart request")
+	}
+
+	requestedAt := time.Now()
+	l.signal(t, syscall.SIGTERM)
+	l.waitEvent(t, "usr2")
+	l.waitEvent(t, "term")
+	if elapsed := time.Since(requestedAt); elapsed < timeout {
+		t.Errorf("child terminated %s after the restart request, before the handoff timeout", elapsed)
+	}
+	select {
+	case <-timedOut:
+	default:
+		t.Error("OnChildTimeout callback not called")
+	}
+	if code := l.wait(t); code != 0 {
+		t.Errorf("launcher exit code = %d, want 0", code)
+	}
+}
+
+// failingStartProcess replaces startProcess until the end of the test with a
+// function failing with errs before succeeding, and returns the number of
+// calls.
+func failingStartProcess(t *testing.T, errs ...error) *int {
+	calls := 0
+	orig := startProcess
+	startProcess = func(name string, argv []string, attr *os.ProcAttr) (*os.Process, error) {
+		calls++
+		if calls <= len(errs) {
+			return nil, errs[calls-1]
+		}
+		return os.FindProcess(os.Getpid())
+	}
+	t.Cleanup(func() {
+		startProcess = orig
+	})
+	return &calls
+}
+
+func TestStartChildRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		attempts  int
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{"success on third attempt", 2, []error{syscall.EAGAIN, syscall.ENOMEM}, 3, false},
+		{"attempts exhausted", 1, []error{syscall.EAGAIN, syscall.EAGAIN}, 2, true},
+		{"permanent error", 2, []error{syscall.ENOENT}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetForTest(t)
+			recordLogs(t)
+			SetChildRestartPolicy(tt.attempts, time.Millisecond)
+			calls := failingStartProcess(t, tt.errs...)
+			_, err := startChild("app", []string{"app"}, &os.ProcAttr{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("startChild() error = %v, want error: %v", err, tt.wantErr)
+			}
+			if *calls != tt.wantCalls {
+				t.Errorf("start attempts = %d, want %d", *calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestExecutableFallback(t *testing.T) {
+	logs := recordLogs(t)
+	origExecutable, origArgs := osExecutable, os.Args
+	defer func() {
+		osExecutable, os.Args = origExecutable, origArgs
+	}()
+	osExecutable = func() (string, error) {
+		return "", errors.New("executable deleted")
+	}
+	want, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := executable()
+	if err != nil {
+		t.Fatalf("executable() = %v", err)
+	}
+	if cmd != want {
+		t.Errorf("executable() = %q, want %q", cmd, want)
+	}
+	if !logs.contains("falling back to os.Args[0]") {
+		t.Error("fallback not logged")
+	}
+
+	os.Args = []string{"seamless-test-no-such-command"}
+	if _, err := executable(); err == nil {
+		t.Error("executable() succeeded without executable")
+	}
+}
+
+func TestUSR1Forwarded(t *testing.T) {
+	resetForTest(t)
+	recordLogs(t)
+	l := startTestLauncher(t, "daemon")
+	l.waitEvent(t, "started")
+	l.signal(t, syscall.SIGUSR1)
+	l.waitEvent(t, "signal "+syscall.SIGUSR1.String())
+	if l.hasEvent("request") {
+		t.Error("USR1 triggered a shutdown request")
+	}
+	if !l.running(50 * time.Millisecond) {
+		t.Error("launcher exited on USR1")
+	}
+}
+
+func TestLauncherRestart(t *testing.T) {
+	resetForTest(t)
+	recordLogs(t)
+	l := startTestLauncher(t, "daemon")
+	l.waitEvent(t, "started")
+	l.signal(t, syscall.SIGTERM)
+	if code := l.wait(t); code != 0 {
+		t.Errorf("launcher exit code = %d, want 0", code)
+	}
+	if !l.hasEvent("request") {
+		t.Error("OnShutdownRequest callback not called before the launcher exited")
+	}
+	// The daemon keeps running, detached, until the new daemon sends it TERM.
+	if err := syscall.Kill(l.childPID(t), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	l.waitEvent(t, "exit")
+	if !l.hasEvent("shutdown") {
+		t.Error("OnShutdown callback not called")
+	}
+}
+
+func TestLauncherHalt(t *testing.T) {
+	resetForTest(t)
+	recordLogs(t)
+	l := startTestLauncher(t, "daemon")
+	l.waitEvent(t, "started")
+	l.halt()
+	if code := l.wait(t); code != -1 {
+		t.Errorf("launcher exit code = %d, want -1", code)
+	}
+	if err := syscall.Kill(l.childPID(t), 0); err != nil {
+		t.Errorf("child not running: %v", err)
+	}
+}
+
+func TestLauncherRestartSignals(t *testing.T) {
+	tests := []struct {
+		name     string
+		restart  []os.Signal
+		sig      syscall.Signal
+		restarts bool
+	}{
+		{"default TERM", nil, syscall.SIGTERM, true},
+		{"default INT", nil, syscall.SIGINT, true},
+		{"TERM only, TERM", []os.Signal{syscall.SIGTERM}, syscall.SIGTERM, true},
+		{"TERM only, INT", []os.Signal{syscall.SIGTERM}, syscall.SIGINT, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetForTest(t)
+			recordLogs(t)
+			if tt.restart != nil {
+				SetRestartSignal(tt.restart...)
+			}
+			l := startTestLauncher(t, "daemon")
+			l.waitEvent(t, "started")
+			l.signal(t, tt.sig)
+			if !tt.restarts {
+				// Not a restart signal: forwarded to the daemon.
+				l.waitEvent(t, "signal "+tt.sig.String())
+				if !l.running(100 * time.Millisecond) {
+					t.Fatal("launcher exited")
+				}
+				if l.hasEvent("request") {
+					t.Error("restart requested")
+				}
+				return
+			}
+			if code := l.wait(t); code != 0 {
+				t.Errorf("launcher exit code = %d, want 0", code)
+			}
+			if !l.hasEvent("request") {
+				t.Error("OnShutdownRequest callback not called")
+			}
+		})
+	}
+}
+
+func TestLauncherInterruptInTerminal(t *testing.T) {
+	resetForTest(t)
+	recordLogs(t)
+	// The launcher runs in a terminal, see detectInteractive.
+	stopOnInterrupt = true
+	l := startTestLauncher(t, "no-ack")
+	l.waitEvent(t, "ready")
+	l.signal(t, syscall.SIGINT)
+	if code := l.wait(t); code != 0 {
+		t.Errorf("launcher exit code = %d, want 0", code)
+	}
+	if !l.hasEvent("term") {
+		t.Error("child not stopped")
+	}
+	if l.hasEvent("usr2") {
+		t.Error("restart requested on INT in a terminal")
+	}
+}
+
+func TestRestartTrigger(t *testing.T) {
+	tests := []struct {
+		name            string
+		restartSignals  []os.Signal
+		stopSignal      os.Signal
+		stopOnInterrupt bool
+		want            os.Signal
+	}{
+		{"default", nil, nil, false, syscall.SIGTERM},
+		{"TERM stops", nil, syscall.SIGTERM, false, syscall.SIGINT},
+		{"terminal", []os.Signal{syscall.SIGINT, syscall.SIGTERM}, nil, true, syscall.SIGTERM},
+		{"terminal INT only", []os.Signal{syscall.SIGINT}, nil, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetForTest(t)
+			if tt.restartSignals != nil {
+				SetRestartSignal(tt.restartSignals...)
+			}
+			if tt.stopSignal != nil {
+				SetStopSignal(tt.stopSignal)
+			}
+			stopOnInterrupt = tt.stopOnInterrupt
+			if got := restartTrigger(); got != tt.want {
+				t.Errorf("restartTrigger() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLauncherRepeatedRestartSignal(t *testing.T) {
+	resetForTest(t)
+	recordLogs(t)
+	SetHandoffTimeout(time.Minute)
+	l := startTestLauncher(t, "no-ack")
+	l.waitEvent(t, "ready")
+	l.signal(t, syscall.SIGTERM)
+	l.waitEvent(t, "usr2")
+	// The child never acknowledges the handoff, the operator insists.
+	l.signal(t, syscall.SIGTERM)
+	l.waitEvent(t, "term")
+	if code := l.wait(t); code != 0 {
+		t.Errorf("launcher exit code = %d, want 0", code)
+	}
+}
+
+func TestLauncherWaitForNewBound(t *testing.T) {
+	tests := []struct {
+		name     string
+		newBound bool
+		want     string
+	}{
+		{"bound", true, "New process started, exiting"},
+		{"timeout", false, "No new process started within the handoff timeout, exiting"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetForTest(t)
+			logs := recordLogs(t)
+			SetLauncherExitPolicy(WaitForNewBound)
+			SetHandoffTimeout(time.Second)
+			l := startTestLauncher(t, "daemon")
+			l.waitEvent(t, "started")
+			l.signal(t, syscall.SIGTERM)
+			l.waitEvent(t, "request")
+			if !l.running(300 * time.Millisecond) {
+				t.Fatal("launcher exited before a new generation was bound")
+			}
+			if tt.newBound {
+				// A new generation calling Started writes its PID.
+				pid := startOldDaemon(t)
+				if err := os.WriteFile(filepath.Join(l.dir, "app.pid"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if code := l.wait(t); code != 0 {
+				t.Errorf("launcher exit code = %d, want 0", code)
+			}
+			if !logs.contains(tt.want) {
+				t.Errorf("%q not logged", tt.want)
+			}
+		})
+	}
+}
+
+func TestLauncherEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		role string
+		want []LauncherEvent
+	}{
+		{"handoff", "daemon", []LauncherEvent{LauncherChildForked, LauncherRestartSignalled, LauncherHandoffAcknowledged}},
+		{"timeout", "no-ack", []LauncherEvent{LauncherChildForked, LauncherRestartSignalled, LauncherChildTimeout}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetForTest(t)
+			recordLogs(t)
+			if tt.role == "no-ack" {
+				SetHandoffTimeout(100 * time.Millisecond)
+			}
+			var events []LauncherEvent
+			OnLauncherEvent(func(event LauncherEvent) { events = append(events, event) })
+			l := startTestLauncher(t, tt.role)
+			if tt.role == "daemon" {
+				l.waitEvent(t, "started")
+			} else {
+				l.waitEvent(t, "ready")
+			}
+			l.signal(t, syscall.SIGTERM)
+			if code := l.wait(t); code != 0 {
+				t.Errorf("launcher exit code = %d, want 0", code)
+			}
+			// LauncherExiting is fired by launch, right before exiting the
+			// process.
+			if !reflect.DeepEqual(events, tt.want) {
+				t.Errorf("events = %v, want %v", events, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package seamless
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// On Windows, the launcher can't be implemented as it relies on Unix signals
+// to drive the restart. Seamless runs in a degraded single process mode where
+// Init always disables seamless restart: Started, Restart and the launcher
+// hooks have no effect and Wait returns immediately.
+const launcherSupported = false
+
+const (
+	// sigShutdownRequest and sigChild have no Windows equivalent and are
+	// never sent.
+	sigShutdownRequest = syscall.Signal(-1)
+	sigChild           = syscall.Signal(-2)
+)
+
+var restartSignals = []os.Signal{syscall.SIGTERM, syscall.SIGINT}
+
+// resetLauncher resets the launcher settings, see Reset.
+func resetLauncher() {
+	restartSignals = []os.Signal{syscall.SIGTERM, syscall.SIGINT}
+	stopOnInterrupt = false
+}
+
+// SetForwardedSignals has no effect on Windows.
+func SetForwardedSignals(sigs ...os.Signal) {
+	if defaultController.inited {
+		panic("seamless.SetForwardedSignals must be called before seamless.Init")
+	}
+}
+
+// SetRestartSignal has no effect on Windows.
+func SetRestartSignal(sigs ...os.Signal) {
+	if defaultController.inited {
+		panic("seamless.SetRestartSignal must be called before seamless.Init")
+	}
+	if len(sigs) == 0 {
+		panic("seamless.SetRestartSignal requires at least one signal")
+	}
+	restartSignals = sigs
+}
+
+// SetChildRestartPolicy has no effect on Windows.
+func SetChildRestartPolicy(maxAttempts int, backoff time.Duration) {
+	if defaultController.inited {
+		panic("seamless.SetChildRestartPolicy must be called before seamless.Init")
+	}
+}
+
+// SetMinChildLifetime has no effect on Windows.
+func SetMinChildLifetime(d time.Duration) {
+	if defaultController.inited {
+		panic("seamless.SetMinChildLifetime must be called before seamless.Init")
+	}
+}
+
+// InitSupervised is like InitErr on Windows: seamless restart is disabled.
+func InitSupervised(pidFile string, opts ...Option) error {
+	return InitErr(pidFile, opts...)
+}
+
+// InitReExec is like InitErr on Windows: seamless restart is disabled.
+func InitReExec(pidFile string, opts ...Option) error {
+	return InitErr(pidFile, opts...)
+}
+
+// InitNoLauncher is like InitErr on Windows: seamless restart is disabled.
+func InitNoLauncher(pidFile string, opts ...Option) error {
+	return InitErr(pidFile, opts...)
+}
+
+// InitNoLauncher disables c on Windows.
+func (c *Controller) InitNoLauncher(pidFile string) error {
+	if c.inited {
+		return ErrAlreadyInitialized
+	}
+	c.inited = true
+	c.pidFilePath = pidFile
+	c.disable()
+	return nil
+}
+
+// ShareListeners has no effect on Windows.
+func ShareListeners(listeners ...net.Listener) {}
+
+// InheritListeners always returns no listeners on Windows as socket
+// activation is not supported.
+func InheritListeners() ([]net.Listener, error) {
+	return nil, nil
+}
+
+// Validate always returns an error on Windows, where seamless restart is not
+// supported.
+func Validate(pidFile string) error {
+	return errors.New("seamless: seamless restart is not supported on this platform")
+}
+
+func ignoreTerminalInterrupt() {}
+
+func detectInteractive() {}
+
+// stopOnInterrupt is never set on Windows.
+var stopOnInterrupt bool
+
+// restartTrigger is never used on Windows.
+func restartTrigger() os.Signal {
+	return nil
+}
+
+func openLauncherAck() {}
+
+func ackHandoff() {}
+
+func launch() {
+	panic("seamless: launcher not supported on windows")
+}
+
+func supervise() {
+	panic("seamless: launcher not supported on windows")
+}
+
+// SetExecLauncher has no effect on Windows.
+func SetExecLauncher(ctx context.Context, configure func(cmd *exec.Cmd)) {
+	if defaultController.inited {
+		panic("seamless.SetExecLauncher must be called before seamless.Init")
+	}
+}
@@ -0,0 +1,56 @@
+package seamless
+
+// LauncherEvent is a step of the child lifecycle as seen by the launcher,
+// reported to the OnLauncherEvent callbacks.
+type LauncherEvent int
+
+const (
+	// LauncherChildForked is fired each time the launcher started the child
+	// process, including relaunches (see SetChildRestartPolicy).
+	LauncherChildForked LauncherEvent = iota
+	// LauncherRestartSignalled is fired once the launcher requested the child
+	// to prepare for a restart (USR2).
+	LauncherRestartSignalled
+	// LauncherHandoffAcknowledged is fired when the child signaled back it is
+	// ready for the new daemon (see SetParentTermSignal).
+	LauncherHandoffAcknowledged
+	// LauncherChildTimeout is fired when the child did not acknowledge the
+	// handoff within the handoff timeout (see SetHandoffTimeout).
+	LauncherChildTimeout
+	// LauncherExiting is fired right before the launcher process exits.
+	LauncherExiting
+)
+
+func (e LauncherEvent) String() string {
+	switch e {
+	case LauncherChildForked:
+		return "child forked"
+	case LauncherRestartSignalled:
+		return "restart signalled"
+	case LauncherHandoffAcknowledged:
+		return "handoff acknowledged"
+	case LauncherChildTimeout:
+		return "child timeout"
+	case LauncherExiting:
+		return "launcher exiting"
+	}
+	return "unknown"
+}
+
+var onLauncherEventFuncs []func(event LauncherEvent)
+
+// OnLauncherEvent registers f to be called in the launcher at each step of
+// the child lifecycle, providing a structured timeline of the restart as seen
+// by the launcher. f is only called in the launcher process, synchronously
+// from the launcher loop, and should not be blocking. It must be registered
+// before Init.
+func OnLauncherEvent(f func(event LauncherEvent)) {
+	onLauncherEventFuncs = append(onLauncherEventFuncs, f)
+}
+
+// fireLauncherEvent calls the OnLauncherEvent callbacks with event.
+func fireLauncherEvent(event LauncherEvent) {
+	for _, f := range onLauncherEventFuncs {
+		f(event)
+	}
+}
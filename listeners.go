@@ -0,0 +1,80 @@
+package seamless
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// WatchListener registers l to be checked across the restart. A warning is
+// logged if l is closed once the OnShutdownRequest callbacks returned, as the
+// daemon then stopped serving before the new daemon is started: listeners
+// must be closed in OnShutdown. A warning is also logged if l is still open
+// once the graceful shutdown completed, as the connections accepted in the
+// meantime are reset when the process exits.
+//
+// The listeners passed to StartedAfterListen or created with ListenUnix or
+// ListenReusePort are watched automatically. Only listeners implementing
+// syscall.Conn, like *net.TCPListener and *net.UnixListener, can be checked.
+func WatchListener(l net.Listener) {
+	defaultController.WatchListener(l)
+}
+
+// WatchListener is like the package level WatchListener function, operating on
+// c.
+func (c *Controller) WatchListener(l net.Listener) {
+	c.hooksMu.Lock()
+	defer c.hooksMu.Unlock()
+	for _, w := range c.listeners {
+		if w == l {
+			return
+		}
+	}
+	c.listeners = append(c.listeners, l)
+}
+
+// listenerErr returns an error if l is not a bound and open listener.
+func listenerErr(l net.Listener) error {
+	if l == nil || l.Addr() == nil {
+		return ErrNotListening
+	}
+	if sc, ok := l.(syscall.Conn); ok {
+		rc, err := sc.SyscallConn()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrNotListening, err)
+		}
+		// Control fails if the listener has been closed.
+		if err = rc.Control(func(fd uintptr) {}); err != nil {
+			return fmt.Errorf("%w: %v", ErrNotListening, err)
+		}
+	}
+	return nil
+}
+
+// checkListeners logs a warning for each watched listener open (or closed if
+// open is false) at the given stage of the restart.
+func (c *Controller) checkListeners(open bool, warning string) {
+	c.hooksMu.Lock()
+	listeners := c.listeners
+	c.hooksMu.Unlock()
+	for _, l := range listeners {
+		if _, ok := l.(syscall.Conn); !ok {
+			continue
+		}
+		if (listenerErr(l) == nil) == open {
+			LogMessage(fmt.Sprintf("WARNING: listener %s %s", l.Addr(), warning))
+		}
+	}
+}
+
+// checkListenersRequested warns about the watched listeners closed by the
+// OnShutdownRequest callbacks.
+func (c *Controller) checkListenersRequested() {
+	c.checkListeners(false, "closed during the shutdown request, the daemon stopped serving before the new daemon is started: close listeners in OnShutdown, not OnShutdownRequest")
+}
+
+// checkListenersShutdown warns about the watched listeners left open by the
+// graceful shutdown.
+func (c *Controller) checkListenersShutdown() {
+	c.checkListeners(true, "still open after the graceful shutdown, close it in OnShutdown")
+}
@@ -0,0 +1,57 @@
+package seamless
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// listen returns a TCP listener on a random local port.
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func TestListenerClosedDuringShutdownRequest(t *testing.T) {
+	d := newTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+	logs := recordLogs(t)
+	l := listen(t)
+	WatchListener(l)
+	OnShutdownRequest(func() { l.Close() })
+	OnShutdown(func() {})
+	d.requestShutdown(t)
+	if !logs.contains("closed during the shutdown request") {
+		t.Error("listener closed during the shutdown request not reported")
+	}
+	d.terminate(t)
+}
+
+func TestListenerLeftOpen(t *testing.T) {
+	for _, closeListener := range []bool{true, false} {
+		t.Run(fmt.Sprintf("close=%v", closeListener), func(t *testing.T) {
+			d := newTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+			logs := recordLogs(t)
+			l := listen(t)
+			WatchListener(l)
+			OnShutdown(func() {
+				if closeListener {
+					l.Close()
+				}
+			})
+			d.requestShutdown(t)
+			d.terminate(t)
+			if logs.contains("closed during the shutdown request") {
+				t.Error("open listener reported as closed during the shutdown request")
+			}
+			if got := logs.contains("still open after the graceful shutdown"); got == closeListener {
+				t.Errorf("open listener reported: %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package seamless
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger is the interface used by seamless to log messages and errors. The kv
+// arguments are alternating key/value pairs giving context to the message.
+//
+// The err argument of Error may be nil for error conditions not caused by an
+// error value.
+type Logger interface {
+	Info(msg string, kv ...interface{})
+	Error(msg string, err error, kv ...interface{})
+}
+
+// logger is the Logger used by the default LogMessage and LogError
+// implementations.
+var logger Logger = stdLogger{}
+
+// SetLogger sets the Logger used by the default LogMessage and LogError
+// implementations. Setting a nil Logger restores the default logger, which
+// writes to the standard log package.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = stdLogger{}
+	}
+	logger = l
+}
+
+// stdLogger is the default Logger, using the standard log package.
+type stdLogger struct{}
+
+func (stdLogger) Info(msg string, kv ...interface{}) {
+	log.Printf("seamless: %s%s", msg, formatKV(kv))
+}
+
+func (stdLogger) Error(msg string, err error, kv ...interface{}) {
+	if err == nil {
+		// Message-only error conditions are logged without a "<nil>" suffix.
+		log.Printf("seamless: %s%s", msg, formatKV(kv))
+		return
+	}
+	log.Printf("seamless: %s: %v%s", msg, err, formatKV(kv))
+}
+
+func formatKV(kv []interface{}) string {
+	if len(kv) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for i := 0; i < len(kv); i += 2 {
+		if i+1 < len(kv) {
+			fmt.Fprintf(&b, " %v=%v", kv[i], kv[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", kv[i])
+		}
+	}
+	return b.String()
+}
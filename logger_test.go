@@ -0,0 +1,30 @@
+package seamless
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestLogErrorNil(t *testing.T) {
+	resetForTest(t)
+	var buf bytes.Buffer
+	out, flags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+	}()
+	LogError("Child timeout, terminating", nil)
+	LogError("Could not fork", errors.New("boom"))
+	want := "seamless: Child timeout, terminating\nseamless: Could not fork: boom\n"
+	if got := buf.String(); got != want {
+		t.Errorf("logs = %q, want %q", got, want)
+	}
+	if strings.Contains(buf.String(), "<nil>") {
+		t.Error("<nil> logged for a message-only error")
+	}
+}
@@ -0,0 +1,46 @@
+package seamless
+
+import "time"
+
+// Metrics holds statistics about the seamless restarts of the daemon.
+type Metrics struct {
+	// Restarts is the number of restarts initiated (shutdown requests
+	// received).
+	Restarts int
+	// HandoffDuration is the duration between the last shutdown request and
+	// the signal sent back to the launcher.
+	HandoffDuration time.Duration
+	// ShutdownDuration is the duration of the last graceful shutdown.
+	ShutdownDuration time.Duration
+	// ShutdownTimedOut is true if the last graceful shutdown has been
+	// triggered by the self shutdown timeout (see SetSelfShutdownTimeout)
+	// instead of the TERM signal from the new daemon.
+	ShutdownTimedOut bool
+	// ShutdownDegraded is true if the last graceful shutdown did not complete
+	// cleanly: its context expired (see SetShutdownTimeout) or was cancelled
+	// before the OnShutdown callbacks returned, or a callback reported it with
+	// MarkShutdownDegraded, like OnShutdownServer does when force closing
+	// the server.
+	ShutdownDegraded bool
+	// SignalFailures is the number of signals driving the restart (handoff
+	// notifications) that could not be sent, even after retries.
+	SignalFailures int
+}
+
+// Stats returns a snapshot of the restart metrics of the current process.
+func Stats() Metrics {
+	return defaultController.Stats()
+}
+
+// Stats is like the package level Stats function, operating on c.
+func (c *Controller) Stats() Metrics {
+	c.metricsMu.Lock()
+	defer c.metricsMu.Unlock()
+	return c.metrics
+}
+
+func (c *Controller) updateMetrics(f func(m *Metrics)) {
+	c.metricsMu.Lock()
+	defer c.metricsMu.Unlock()
+	f(&c.metrics)
+}
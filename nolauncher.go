@@ -0,0 +1,75 @@
+//go:build !windows
+// +build !windows
+
+package seamless
+
+import (
+	"os"
+)
+
+// InitNoLauncher initializes seamless without the launcher generation, for
+// environments where forking is undesirable, like containers running the
+// daemon as PID 1. Stopping the daemon is left to the orchestrator (e.g. a
+// Kubernetes preStop hook followed by a TERM signal).
+//
+// The Started, OnShutdown and Wait lifecycle is preserved: the new instance
+// calls Started to notify the old one through the PID file (or the control
+// socket, see UseControlSocket), and the old instance engages its graceful
+// shutdown when it receives a TERM signal, whether sent by the new instance or
+// by the orchestrator. As there is no shutdown request, OnShutdownRequest
+// callbacks are never called and Restart returns ErrNoLauncher.
+//
+// As for Init, an empty pidFile disables seamless and an error is returned if
+// the PID file directory is not writable.
+func InitNoLauncher(pidFile string, opts ...Option) error {
+	if defaultController.inited {
+		return ErrAlreadyInitialized
+	}
+	applyOptions(opts)
+	return defaultController.InitNoLauncher(pidFile)
+}
+
+// InitNoLauncher is like the package level InitNoLauncher function, operating
+// on c. It is the only way to initialize controllers other than the default
+// one (see Controller).
+func (c *Controller) InitNoLauncher(pidFile string) error {
+	if c.inited {
+		return ErrAlreadyInitialized
+	}
+	c.inited = true
+	c.noLauncherMode = true
+
+	if pidFile == "" {
+		c.disable()
+		return nil
+	}
+	c.pidFilePath = pidFile
+
+	if forceDisabled || os.Getenv("SEAMLESS_DISABLE") == "1" {
+		LogMessage("Seamless restart disabled")
+		c.disable()
+		return nil
+	}
+
+	if err := c.checkDirs(); err != nil {
+		LogError("Seamless restart disabled", err)
+		c.disable()
+		return err
+	}
+
+	if c.isDefault() {
+		setProcTitle("")
+	}
+	go c.waitTerm(c.termC())
+	return nil
+}
+
+// waitTerm engages the graceful shutdown when a TERM signal is received on
+// term or the new instance announced itself on the control socket.
+func (c *Controller) waitTerm(term chan os.Signal) {
+	select {
+	case <-term:
+	case <-c.controlC():
+	}
+	c.shutdown(ReasonSignal, term)
+}
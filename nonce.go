@@ -0,0 +1,91 @@
+package seamless
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The launcher identifies the daemon it starts with a random nonce, passed to
+// the daemon in the SEAMLESS_NONCE environment variable and written to a file
+// next to the PID file, named after the launcher PID. A process only takes the
+// daemon path if the nonce in its environment matches the one of its parent,
+// so a SEAMLESS environment variable leaked to an unrelated process whose
+// parent PID happens to match (after PID reuse for instance) is not mistaken
+// for a daemon started by a launcher. The nonce file is removed when the
+// launcher exits, and the nonce files left by dead launchers (killed with
+// SIGKILL for instance) are removed by the next launcher.
+
+// launcherNoncePath returns the path of the nonce file of the launcher pid.
+func launcherNoncePath(pidFile string, pid int) string {
+	return fmt.Sprintf("%s.launcher-%d", pidFile, pid)
+}
+
+// writeLauncherNonce generates the nonce of the current process as a
+// launcher, writes it to its nonce file and sets it in the environment
+// inherited by the daemon.
+func writeLauncherNonce(pidFile string) error {
+	removeStaleLauncherNonces(pidFile)
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	nonce := hex.EncodeToString(b)
+	if err := writeFileAtomic(launcherNoncePath(pidFile, os.Getpid()), nonce+"\n"); err != nil {
+		return err
+	}
+	return os.Setenv("SEAMLESS_NONCE", nonce)
+}
+
+// removeStaleLauncherNonces removes the nonce files of the launchers which are
+// not running any more, so a PID reused by another launcher can't match a
+// stale nonce.
+func removeStaleLauncherNonces(pidFile string) {
+	prefix := filepath.Base(pidFile) + ".launcher-"
+	entries, err := os.ReadDir(filepath.Dir(pidFile))
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), prefix) {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimPrefix(e.Name(), prefix))
+		if err != nil || pid <= 0 || processAlive(pid) {
+			continue
+		}
+		if err := os.Remove(launcherNoncePath(pidFile, pid)); err != nil && !os.IsNotExist(err) {
+			LogError("Could not remove stale launcher nonce file", err)
+		}
+	}
+}
+
+// removeLauncherNonce removes the nonce file of the current process.
+func removeLauncherNonce(pidFile string) {
+	if err := os.Remove(launcherNoncePath(pidFile, os.Getpid())); err != nil && !os.IsNotExist(err) {
+		LogError("Could not remove launcher nonce file", err)
+	}
+}
+
+// launchedByLauncher reports whether the current process has been started by
+// a launcher. Without pidFile, as before Init, only the SEAMLESS environment
+// variable is checked.
+func launchedByLauncher(pidFile string) bool {
+	if os.Getenv("SEAMLESS") != strconv.Itoa(os.Getppid()) {
+		return false
+	}
+	if pidFile == "" {
+		return true
+	}
+	nonce := os.Getenv("SEAMLESS_NONCE")
+	b, err := readPIDFile(launcherNoncePath(pidFile, os.Getppid()))
+	if nonce == "" || err != nil || strings.TrimSpace(string(b)) != nonce {
+		LogMessage("SEAMLESS environment variable not set by the parent process, ignoring it")
+		return false
+	}
+	return true
+}
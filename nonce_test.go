@@ -0,0 +1,50 @@
+package seamless
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestLaunchedByLauncher(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, pidFile string)
+		want  bool
+	}{
+		{"launched", func(t *testing.T, pidFile string) {}, true},
+		{"wrong nonce", func(t *testing.T, pidFile string) {
+			// The environment leaked from another launcher.
+			t.Setenv("SEAMLESS_NONCE", "leaked")
+		}, false},
+		{"no nonce", func(t *testing.T, pidFile string) {
+			t.Setenv("SEAMLESS_NONCE", "")
+		}, false},
+		{"no nonce file", func(t *testing.T, pidFile string) {
+			if err := os.Remove(launcherNoncePath(pidFile, os.Getppid())); err != nil {
+				t.Fatal(err)
+			}
+		}, false},
+		{"other parent", func(t *testing.T, pidFile string) {
+			t.Setenv("SEAMLESS", strconv.Itoa(os.Getpid()))
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetForTest(t)
+			recordLogs(t)
+			pidFile := filepath.Join(t.TempDir(), "app.pid")
+			setLauncherEnv(t, pidFile)
+			tt.setup(t, pidFile)
+			if got := launchedByLauncher(pidFile); got != tt.want {
+				t.Errorf("launchedByLauncher() = %v, want %v", got, tt.want)
+			}
+			// A process not launched by a launcher launches the daemon.
+			defaultController.pidFilePath = pidFile
+			if got := IsLauncher(); got != !tt.want {
+				t.Errorf("IsLauncher() = %v, want %v", got, !tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package seamless
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Option configures seamless at Init time. Each option is equivalent to the
+// corresponding setter function called before Init.
+type Option struct {
+	apply func()
+}
+
+// applyOptions applies opts. It must be called before seamless is marked as
+// initialized, as the setters panic afterwards.
+func applyOptions(opts []Option) {
+	for _, opt := range opts {
+		opt.apply()
+	}
+}
+
+// WithHandoffTimeout is the Option form of SetHandoffTimeout.
+func WithHandoffTimeout(d time.Duration) Option {
+	return Option{func() { SetHandoffTimeout(d) }}
+}
+
+// WithSelfShutdownTimeout is the Option form of SetSelfShutdownTimeout.
+func WithSelfShutdownTimeout(d time.Duration) Option {
+	return Option{func() { SetSelfShutdownTimeout(d) }}
+}
+
+// WithShutdownRequestTimeout is the Option form of SetShutdownRequestTimeout.
+func WithShutdownRequestTimeout(d time.Duration) Option {
+	return Option{func() { SetShutdownRequestTimeout(d) }}
+}
+
+// WithTermTimeout is the Option form of SetTermTimeout.
+//
+// Deprecated: use WithSelfShutdownTimeout.
+func WithTermTimeout(d time.Duration) Option {
+	return Option{func() { SetTermTimeout(d) }}
+}
+
+// WithProcTitlePrefix is the Option form of SetProcTitlePrefix.
+func WithProcTitlePrefix(prefix string) Option {
+	return Option{func() { SetProcTitlePrefix(prefix) }}
+}
+
+// WithLogger is the Option form of SetLogger.
+func WithLogger(l Logger) Option {
+	return Option{func() { SetLogger(l) }}
+}
+
+// WithRestartSignal is the Option form of SetRestartSignal.
+func WithRestartSignal(sigs ...os.Signal) Option {
+	return Option{func() { SetRestartSignal(sigs...) }}
+}
+
+// WithStopSignal is the Option form of SetStopSignal.
+func WithStopSignal(sig os.Signal) Option {
+	return Option{func() { SetStopSignal(sig) }}
+}
+
+// WithTermSignal is the Option form of SetTermSignal.
+func WithTermSignal(sig os.Signal) Option {
+	return Option{func() { SetTermSignal(sig) }}
+}
+
+// WithExecLauncher is the Option form of SetExecLauncher.
+func WithExecLauncher(ctx context.Context, configure func(cmd *exec.Cmd)) Option {
+	return Option{func() { SetExecLauncher(ctx, configure) }}
+}
+
+// WithoutSupervisorWarning is the Option form of DisableSupervisorWarning.
+func WithoutSupervisorWarning() Option {
+	return Option{DisableSupervisorWarning}
+}
+
+// WithPIDFileMode is the Option form of SetPIDFileMode.
+func WithPIDFileMode(mode os.FileMode) Option {
+	return Option{func() { SetPIDFileMode(mode) }}
+}
@@ -0,0 +1,64 @@
+package seamless
+
+import (
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// testLogger is a Logger discarding the logs.
+type testLogger struct{}
+
+func (testLogger) Info(msg string, kv ...interface{})             {}
+func (testLogger) Error(msg string, err error, kv ...interface{}) {}
+
+func TestInitOptions(t *testing.T) {
+	resetForTest(t)
+	err := InitErr("",
+		WithHandoffTimeout(time.Minute),
+		WithSelfShutdownTimeout(2*time.Minute),
+		WithShutdownRequestTimeout(3*time.Minute),
+		WithLogger(testLogger{}),
+		WithRestartSignal(syscall.SIGHUP),
+		WithPIDFileMode(0600),
+		WithoutSupervisorWarning())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handoffTimeout != time.Minute {
+		t.Errorf("handoff timeout = %s, want %s", handoffTimeout, time.Minute)
+	}
+	if termTimeout != 2*time.Minute {
+		t.Errorf("self shutdown timeout = %s, want %s", termTimeout, 2*time.Minute)
+	}
+	if requestTimeout != 3*time.Minute {
+		t.Errorf("shutdown request timeout = %s, want %s", requestTimeout, 3*time.Minute)
+	}
+	if logger != (testLogger{}) {
+		t.Errorf("logger = %#v, want testLogger", logger)
+	}
+	if want := []os.Signal{syscall.SIGHUP}; !reflect.DeepEqual(restartSignals, want) {
+		t.Errorf("restart signals = %v, want %v", restartSignals, want)
+	}
+	if pidFileMode != 0600 {
+		t.Errorf("PID file mode = %v, want %v", pidFileMode, os.FileMode(0600))
+	}
+	if supervisorWarning {
+		t.Error("supervisor warning enabled")
+	}
+}
+
+func TestInitNoOptions(t *testing.T) {
+	resetForTest(t)
+	if err := InitErr(""); err != nil {
+		t.Fatal(err)
+	}
+	if handoffTimeout != 10*time.Second {
+		t.Errorf("handoff timeout = %s, want the default %s", handoffTimeout, 10*time.Second)
+	}
+	if pidFileMode != 0644 {
+		t.Errorf("PID file mode = %v, want the default %v", pidFileMode, os.FileMode(0644))
+	}
+}
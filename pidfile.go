@@ -0,0 +1,217 @@
+package seamless
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// pidFileMetadata enables the key=value PID file format.
+	pidFileMetadata bool
+	pidFileVersion  string
+	startTime       = time.Now()
+)
+
+// SetPIDFileMetadata makes the PID file hold metadata in addition to the PID:
+// the process start time and the given version string. The file is then
+// written as key=value lines:
+//
+//	pid=1234
+//	started=2017-01-02T15:04:05Z
+//	version=v1.2.3
+//
+// PID files holding only the PID, as written by default, are still
+// understood.
+func SetPIDFileMetadata(version string) {
+	if defaultController.inited {
+		panic("seamless.SetPIDFileMetadata must be called before seamless.Init")
+	}
+	pidFileMetadata = true
+	pidFileVersion = version
+}
+
+// pidFileInfo is the content of a PID file.
+type pidFileInfo struct {
+	PID     int
+	Started time.Time
+	Version string
+	// Written is the time the PID file was last written, zero if unknown.
+	// It is not part of the content and only set when reading a PID file.
+	Written time.Time
+}
+
+func currentPIDFileInfo() pidFileInfo {
+	info := pidFileInfo{PID: os.Getpid()}
+	if pidFileMetadata {
+		info.Started = startTime
+		info.Version = pidFileVersion
+	}
+	return info
+}
+
+// format returns the PID file content for info.
+func (info pidFileInfo) format() string {
+	if info.Started.IsZero() && info.Version == "" {
+		return strconv.Itoa(info.PID)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "pid=%d\n", info.PID)
+	if !info.Started.IsZero() {
+		fmt.Fprintf(&b, "started=%s\n", info.Started.UTC().Format(time.RFC3339))
+	}
+	if info.Version != "" {
+		fmt.Fprintf(&b, "version=%s\n", info.Version)
+	}
+	return b.String()
+}
+
+func (info pidFileInfo) String() string {
+	s := "pid " + strconv.Itoa(info.PID)
+	if !info.Started.IsZero() {
+		s += ", started " + info.Started.Format(time.RFC3339)
+	}
+	if info.Version != "" {
+		s += ", version " + info.Version
+	}
+	return s
+}
+
+// parsePIDFile parses the PID file content b, in either the plain PID or the
+// key=value format.
+func parsePIDFile(b []byte) (pidFileInfo, error) {
+	var info pidFileInfo
+	content := strings.TrimSpace(string(b))
+	if !strings.Contains(content, "=") {
+		pid, err := strconv.Atoi(content)
+		if err != nil {
+			return info, err
+		}
+		if pid <= 0 {
+			return info, fmt.Errorf("invalid pid %d", pid)
+		}
+		info.PID = pid
+		return info, nil
+	}
+	for _, line := range strings.Split(content, "\n") {
+		kv := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "pid":
+			pid, err := strconv.Atoi(kv[1])
+			if err != nil {
+				return info, err
+			}
+			info.PID = pid
+		case "started":
+			info.Started, _ = time.Parse(time.RFC3339, kv[1])
+		case "version":
+			info.Version = kv[1]
+		}
+	}
+	if info.PID == 0 {
+		return info, errors.New("missing pid")
+	}
+	if info.PID < 0 {
+		return info, fmt.Errorf("invalid pid %d", info.PID)
+	}
+	return info, nil
+}
+
+// maxPIDFileSize is the size above which a PID file is considered corrupted,
+// for instance overwritten by a log, and is not read.
+const maxPIDFileSize = 4096
+
+// readPIDFile returns the content of the PID file at path, reading at most
+// maxPIDFileSize bytes.
+func readPIDFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(io.LimitReader(f, maxPIDFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxPIDFileSize {
+		return nil, fmt.Errorf("file larger than %d bytes", maxPIDFileSize)
+	}
+	return b, nil
+}
+
+// modTime returns the modification time of the file at path, or the zero time
+// if it cannot be determined.
+func modTime(path string) time.Time {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// writePIDFile atomically writes info to path.
+func writePIDFile(path string, info pidFileInfo) error {
+	return writeFileAtomic(path, info.format())
+}
+
+// writeFileAtomic writes content to path by writing a temporary file in the
+// same directory and renaming it into place, so readers never see a partially
+// written file. The file gets the PID file mode and owner.
+func writeFileAtomic(path, content string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp) // no-op once renamed
+	if _, err = f.WriteString(content); err == nil {
+		err = f.Chmod(pidFileMode)
+	}
+	if err == nil && (pidFileUID >= 0 || pidFileGID >= 0) {
+		// Best effort: the ownership is not critical to the restart.
+		if cerr := f.Chown(pidFileUID, pidFileGID); cerr != nil {
+			LogError("Could not change PID file ownership", cerr)
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// checkWritableDir checks that the directory holding path exists and that
+// files can be created in it, the way writePIDFile does.
+func checkWritableDir(path string) error {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("seamless: directory %s is not writable: %w", dir, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return nil
+}
+
+// checkDirs checks the directories of the PID file and the control socket are
+// writable, so a misconfiguration is caught at Init rather than in the middle
+// of a restart.
+func (c *Controller) checkDirs() error {
+	if err := checkWritableDir(c.pidFilePath); err != nil {
+		return err
+	}
+	if controlPath != "" && c.isDefault() {
+		return checkWritableDir(controlPath)
+	}
+	return nil
+}
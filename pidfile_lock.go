@@ -0,0 +1,42 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package seamless
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockPIDFile takes an exclusive lock on a lock file next to the PID file at
+// path, so new generations started concurrently (e.g. by a supervisor in a
+// crash loop) coordinate the handoff one at a time instead of racing on the
+// PID file. A generation finding the lock taken does not wait: ok is false so
+// it backs off, leaving the handoff to the generation holding the lock. If the
+// lock can't be taken for another reason, the error is logged and ok is true
+// so the handoff proceeds unlocked. The lock file is never removed, as
+// removing it would let two processes hold a lock on different files.
+//
+// The returned unlock function releases the lock, it is never nil.
+func lockPIDFile(path string) (unlock func(), ok bool) {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, pidFileMode)
+	if err != nil {
+		LogError("Could not open PID lock file", err)
+		return func() {}, true
+	}
+	fd := int(f.Fd())
+	err = syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		f.Close()
+		return func() {}, false
+	}
+	if err != nil {
+		LogError("Could not lock PID file", err)
+		f.Close()
+		return func() {}, true
+	}
+	return func() {
+		_ = syscall.Flock(fd, syscall.LOCK_UN)
+		f.Close()
+	}, true
+}
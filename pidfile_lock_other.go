@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package seamless
+
+// lockPIDFile is a no-op on platforms without flock: concurrent new
+// generations are not serialized.
+func lockPIDFile(path string) (unlock func(), ok bool) {
+	return func() {}, true
+}
@@ -0,0 +1,57 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package seamless
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLockPIDFile(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	unlock, ok := lockPIDFile(pidFile)
+	if !ok {
+		t.Fatal("lock not taken")
+	}
+	if _, ok := lockPIDFile(pidFile); ok {
+		t.Fatal("lock taken twice")
+	}
+	unlock()
+	unlock, ok = lockPIDFile(pidFile)
+	if !ok {
+		t.Fatal("lock not taken once released")
+	}
+	unlock()
+}
+
+func TestStartedBacksOff(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	newTestDaemon(t, pidFile)
+	logs := recordLogs(t)
+	sigs := recordSignals(t)
+	if err := os.WriteFile(pidFile, []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Another new generation is coordinating its handoff.
+	unlock, ok := lockPIDFile(pidFile)
+	if !ok {
+		t.Fatal("lock not taken")
+	}
+	defer unlock()
+	Started()
+	if !logs.contains("another restart is in progress") {
+		t.Error("back off not logged")
+	}
+	if s := sigs.signals(); len(s) != 0 {
+		t.Errorf("signals sent: %v", s)
+	}
+	b, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "1" {
+		t.Errorf("PID file overwritten with %q", b)
+	}
+}
@@ -0,0 +1,67 @@
+package seamless
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	resetForTest(t)
+	path := filepath.Join(t.TempDir(), "app.pid")
+	contents := []string{"1", strings.Repeat("x", 4000)}
+	if err := writeFileAtomic(path, contents[0]); err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				done <- nil
+				return
+			default:
+			}
+			if err := writeFileAtomic(path, contents[i%2]); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		b, err := readPIDFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := string(b); s != contents[0] && s != contents[1] {
+			t.Fatalf("read partial content (%d bytes)", len(s))
+		}
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPIDFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes not supported")
+	}
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	resetForTest(t)
+	SetPIDFileMode(0600)
+	initTestDaemon(t, pidFile)
+	Started()
+	fi, err := os.Stat(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0600 {
+		t.Errorf("PID file mode = %v, want %v", mode, os.FileMode(0600))
+	}
+}
@@ -0,0 +1,47 @@
+package seamless
+
+// procTitlePrefix is the process title prefix set with SetProcTitlePrefix.
+var procTitlePrefix string
+
+// maxProcTitleLen is the maximum length of a process title, the size of the
+// kernel task name on Linux without its terminating NUL byte.
+const maxProcTitleLen = 15
+
+// SetProcTitlePrefix makes seamless set the process title to prefix followed
+// by the role of the process, so the generations are told apart with ps or
+// top during a restart: "prefix [launcher]" for the launcher, prefix alone for
+// the serving daemon and "prefix [draining]" once its graceful shutdown began.
+//
+// On Linux, the title is the task name shown by ps -o comm and top (see
+// PR_SET_NAME in prctl(2)), limited to 15 bytes: the prefix is truncated so
+// the role stays visible. The full command line is left untouched. Setting
+// the title is best effort and a no-op on other platforms.
+//
+// The process title is handled by the default controller only.
+func SetProcTitlePrefix(prefix string) {
+	if defaultController.inited {
+		panic("seamless.SetProcTitlePrefix must be called before seamless.Init")
+	}
+	procTitlePrefix = prefix
+}
+
+// setProcTitle sets the process title for role, or to the prefix alone if role
+// is empty. It is a no-op if no prefix is set.
+func setProcTitle(role string) {
+	if procTitlePrefix == "" {
+		return
+	}
+	prefix, suffix := procTitlePrefix, ""
+	if role != "" {
+		suffix = " [" + role + "]"
+	}
+	if n := maxProcTitleLen - len(suffix); len(prefix) > n {
+		if n < 0 {
+			n = 0
+		}
+		prefix = prefix[:n]
+	}
+	if err := setProcName(prefix + suffix); err != nil {
+		LogError("Could not set process title", err)
+	}
+}
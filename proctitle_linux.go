@@ -0,0 +1,11 @@
+package seamless
+
+import "os"
+
+// setProcName sets the name of the main thread of the process, which ps and
+// top report as the process name. PR_SET_NAME would only rename the thread
+// running the calling goroutine, writing the comm file of the process renames
+// the main thread instead.
+func setProcName(name string) error {
+	return os.WriteFile("/proc/self/comm", []byte(name), 0)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package seamless
+
+// setProcName is a no-op on platforms without a settable process name.
+func setProcName(name string) error {
+	return nil
+}
@@ -0,0 +1,114 @@
+package seamless
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readinessPath is the readiness file set with SetReadinessFile.
+var readinessPath string
+
+// SetReadinessFile makes the daemon create a readiness file at path once
+// Started is called, and remove it when its graceful shutdown begins, before
+// the OnShutdown callbacks are called. Load balancer health checks (like an
+// HAProxy agent-check) or supervisors watching this file stop routing traffic
+// to a host before it drains.
+//
+// The file holds the PID of the daemon which created it. As the new daemon
+// creates it before the old one shuts down, the old daemon only removes the
+// file if it still holds its own PID, so a restart leaves the file in place.
+// Failing to create or remove the file is logged and does not prevent the
+// restart.
+//
+// The readiness file is handled by the default controller only.
+func SetReadinessFile(path string) {
+	if defaultController.inited {
+		panic("seamless.SetReadinessFile must be called before seamless.Init")
+	}
+	readinessPath = path
+}
+
+// createReadinessFile creates the readiness file, if any.
+func (c *Controller) createReadinessFile() {
+	if readinessPath == "" || !c.isDefault() {
+		return
+	}
+	if err := writeFileAtomic(readinessPath, strconv.Itoa(os.Getpid())+"\n"); err != nil {
+		LogError("Could not create readiness file", err)
+	}
+}
+
+// removeReadinessFile removes the readiness file, if any, unless it has been
+// replaced by a newer daemon.
+func (c *Controller) removeReadinessFile() {
+	if readinessPath == "" || !c.isDefault() {
+		return
+	}
+	b, err := os.ReadFile(readinessPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			LogError("Could not read readiness file", err)
+		}
+		return
+	}
+	if pid, _ := strconv.Atoi(strings.TrimSpace(string(b))); pid != os.Getpid() {
+		LogMessage(fmt.Sprintf("Readiness file owned by process %d, leaving it", pid))
+		return
+	}
+	if err := os.Remove(readinessPath); err != nil && !os.IsNotExist(err) {
+		LogError("Could not remove readiness file", err)
+	}
+}
+
+// readyFD is the readiness file descriptor set with SetReadyFD, -1 if none.
+var readyFD = -1
+
+// SetReadyFD makes Started write a newline to the inherited file descriptor
+// fd, then close it, for wrappers spawning the daemon with a readiness pipe
+// (like s6 or daemontools-style readiness notification). The descriptor can
+// also be set with the SEAMLESS_READY_FD environment variable, which takes
+// precedence. The launcher passes the descriptor on to the daemon it starts.
+//
+// Failing to write to the descriptor, for instance because it is closed or
+// the reading end is gone, is logged and does not prevent the daemon from
+// starting.
+func SetReadyFD(fd int) {
+	if defaultController.inited {
+		panic("seamless.SetReadyFD must be called before seamless.Init")
+	}
+	readyFD = fd
+}
+
+// readyFDNumber returns the readiness file descriptor, -1 if none.
+func readyFDNumber() int {
+	if s := os.Getenv("SEAMLESS_READY_FD"); s != "" {
+		fd, err := strconv.Atoi(s)
+		if err != nil || fd < 0 {
+			LogError("Ignoring SEAMLESS_READY_FD", fmt.Errorf("invalid file descriptor %q", s))
+			return -1
+		}
+		return fd
+	}
+	return readyFD
+}
+
+// notifyReadyFD writes the readiness notification to the readiness file
+// descriptor, if any.
+func (c *Controller) notifyReadyFD() {
+	if !c.isDefault() {
+		return
+	}
+	fd := readyFDNumber()
+	if fd < 0 {
+		return
+	}
+	// The descriptor is not valid for the processes we start.
+	os.Unsetenv("SEAMLESS_READY_FD")
+	f := os.NewFile(uintptr(fd), "ready")
+	if _, err := f.Write([]byte{'\n'}); err != nil {
+		LogError(fmt.Sprintf("Could not write to readiness file descriptor %d", fd), err)
+	}
+	f.Close()
+}
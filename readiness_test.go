@@ -0,0 +1,88 @@
+//go:build !windows
+// +build !windows
+
+package seamless
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+// readyPipe returns a pipe and a duplicate of its end, end being 0 for the
+// read end and 1 for the write end, to be passed as the readiness file
+// descriptor, which Started closes.
+func readyPipe(t *testing.T, end int) (r, w *os.File, fd int) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		r.Close()
+		w.Close()
+	})
+	f := w
+	if end == 0 {
+		f = r
+	}
+	fd, err = syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, w, fd
+}
+
+func TestReadyFD(t *testing.T) {
+	for _, env := range []bool{false, true} {
+		name := "SetReadyFD"
+		if env {
+			name = "SEAMLESS_READY_FD"
+		}
+		t.Run(name, func(t *testing.T) {
+			resetForTest(t)
+			r, w, fd := readyPipe(t, 1)
+			if env {
+				t.Setenv("SEAMLESS_READY_FD", strconv.Itoa(fd))
+			} else {
+				SetReadyFD(fd)
+			}
+			initTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+			Started()
+			b := make([]byte, 2)
+			n, err := r.Read(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(b[:n]); got != "\n" {
+				t.Errorf("readiness notification = %q, want %q", got, "\n")
+			}
+			// The descriptor is closed once notified: with the original
+			// write end closed too, the read end reports EOF.
+			w.Close()
+			if _, err := r.Read(b); err == nil {
+				t.Error("readiness file descriptor left open")
+			}
+		})
+	}
+}
+
+func TestReadyFDInvalid(t *testing.T) {
+	resetForTest(t)
+	// Writing to the read end of a pipe fails.
+	_, _, fd := readyPipe(t, 0)
+	SetReadyFD(fd)
+	initTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+	logs := recordLogs(t)
+	started := false
+	OnStarted(func() { started = true })
+	Started()
+	if !logs.contains("Could not write to readiness file descriptor") {
+		t.Error("write failure not logged")
+	}
+	if !started {
+		t.Error("Started did not complete")
+	}
+}
@@ -0,0 +1,165 @@
+//go:build !windows
+// +build !windows
+
+package seamless
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+)
+
+// sharedListeners are the listeners passed to the new process in re-exec mode.
+var sharedListeners []net.Listener
+
+// InitReExec initializes seamless in re-exec mode, an alternative to the
+// launcher model of Init for process managers not expecting a supervised
+// non-forking daemon (or when no supervisor is used at all).
+//
+// In re-exec mode, there is no launcher: the daemon is the process started by
+// the user. When it receives a USR2 signal, the OnShutdownRequest callbacks
+// are called and the daemon starts a new instance of itself, passing it the
+// listeners registered with ShareListeners. The new instance gets them back
+// using InheritListeners. Once the new instance calls Started, the old one
+// receives a TERM signal and engages its graceful shutdown, as in the launcher
+// model. If the new instance exits before calling Started, the restart is
+// aborted and the old instance keeps serving.
+//
+// Pick Init with supervisors like daemontools, runit or systemd which expect
+// the daemon not to fork and restart it when it exits. Pick InitReExec with
+// process managers tracking the daemon through its PID file, like nginx or
+// unicorn do, as the new instance is not a child of the supervisor.
+//
+// As for Init, an empty pidFile disables seamless and an error is returned if
+// the PID file directory is not writable.
+func InitReExec(pidFile string, opts ...Option) error {
+	c := defaultController
+	if c.inited {
+		return ErrAlreadyInitialized
+	}
+	applyOptions(opts)
+	c.inited = true
+	c.reexecMode = true
+
+	if pidFile == "" {
+		c.disable()
+		return nil
+	}
+	c.pidFilePath = pidFile
+
+	if forceDisabled || os.Getenv("SEAMLESS_DISABLE") == "1" {
+		LogMessage("Seamless restart disabled")
+		c.disable()
+		return nil
+	}
+
+	if err := c.checkDirs(); err != nil {
+		LogError("Seamless restart disabled", err)
+		c.disable()
+		return err
+	}
+
+	setProcTitle("")
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, sigShutdownRequest)
+	go c.reexecLoop(sigs)
+	return nil
+}
+
+// ShareListeners registers listeners to be passed to the new instance started
+// in re-exec mode (see InitReExec). The new instance gets them back in the
+// same order with InheritListeners. Listeners must be *net.TCPListener or
+// *net.UnixListener (or any listener with a File method).
+func ShareListeners(listeners ...net.Listener) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	sharedListeners = listeners
+}
+
+func (c *Controller) reexecLoop(sigs chan os.Signal) {
+	for range sigs {
+		c.setState(StateRequested)
+		LogMessage("Restart requested")
+		c.hooksMu.Lock()
+		funcs := c.shutdownRequestFuncs
+		c.hooksMu.Unlock()
+		callShutdownRequestFuncs(funcs)
+		c.checkListenersRequested()
+		if atomic.SwapInt32(&c.restartAborted, 0) == 1 {
+			LogMessage("Restart aborted")
+			c.setState(StateRunning)
+			continue
+		}
+
+		// Watch for TERM before starting the new process, which sends it as
+		// soon as it is started.
+		term := notifyTerm()
+		p, err := reexec()
+		if err != nil {
+			signal.Stop(term)
+			LogError("Could not start new process, restart aborted", err)
+			c.setState(StateRunning)
+			continue
+		}
+		c.setState(StateReady)
+		exited := make(chan struct{})
+		go func() {
+			_, _ = p.Wait()
+			close(exited)
+		}()
+
+		LogMessage("Ready, waiting for TERM signal")
+		select {
+		case <-term:
+			signal.Stop(sigs)
+			c.shutdown(ReasonSignal, term)
+			return
+		case <-exited:
+			signal.Stop(term)
+			LogError("Restart aborted", fmt.Errorf("new process %d exited before being started", p.Pid))
+			c.setState(StateRunning)
+		}
+	}
+}
+
+// reexec starts a new instance of the current program passing the shared
+// listeners using the socket activation convention.
+func reexec() (*os.Process, error) {
+	cmd, err := executable()
+	if err != nil {
+		return nil, err
+	}
+	hooksMu.Lock()
+	listeners := sharedListeners
+	hooksMu.Unlock()
+	files := []*os.File{os.Stdin, os.Stdout, os.Stderr}
+	for _, l := range listeners {
+		fl, ok := l.(interface{ File() (*os.File, error) })
+		if !ok {
+			return nil, fmt.Errorf("listener %T does not expose its file descriptor", l)
+		}
+		f, err := fl.File()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		files = append(files, f)
+	}
+	pid := strconv.Itoa(os.Getpid())
+	env := setEnv(os.Environ(), "SEAMLESS", pid)
+	env = setEnv(env, "LISTEN_PID", pid)
+	env = setEnv(env, "LISTEN_FDS", strconv.Itoa(len(listeners)))
+	attrs := &os.ProcAttr{
+		Files: append(files, extraFiles...),
+		Env:   env,
+	}
+	p, err := startProcess(cmd, os.Args, attrs)
+	if err != nil {
+		return nil, err
+	}
+	LogMessage(fmt.Sprintf("Started new process %d", p.Pid))
+	return p, nil
+}
@@ -0,0 +1,53 @@
+package seamless
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var (
+	reloadOnce  sync.Once
+	reloadFuncs []func() error
+)
+
+// OnReload set f to be called when the daemon receives a HUP signal, forwarded
+// by the launcher by default. It is intended to reload hot-reloadable resources
+// like TLS certificates or configuration in the current process, without any
+// restart. Errors returned by f are logged.
+//
+// In supervised mode (see InitSupervised), the HUP signal received by the
+// launcher triggers a restart instead unless other restart signals are set
+// with SetRestartSignal: send the HUP signal to the daemon directly to reload
+// it.
+//
+// The HUP signal handler is installed on the first call to OnReload, so the
+// default behavior of the HUP signal is kept if no reload callback is
+// registered.
+func OnReload(f func() error) {
+	hooksMu.Lock()
+	reloadFuncs = append(reloadFuncs, f)
+	hooksMu.Unlock()
+	reloadOnce.Do(func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGHUP)
+		go reload(c)
+	})
+}
+
+func reload(c chan os.Signal) {
+	for range c {
+		LogMessage("Reload requested")
+		hooksMu.Lock()
+		funcs := reloadFuncs
+		hooksMu.Unlock()
+		for _, f := range funcs {
+			callSafe("OnReload", func() {
+				if err := f(); err != nil {
+					LogError("Reload error", err)
+				}
+			})
+		}
+	}
+}
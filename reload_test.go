@@ -0,0 +1,37 @@
+package seamless
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestReloadCallbackPanic(t *testing.T) {
+	resetForTest(t)
+	logs := recordLogs(t)
+	reloaded := false
+	OnReload(func() error { panic("reload") })
+	OnReload(func() error { return errors.New("bad config") })
+	OnReload(func() error {
+		reloaded = true
+		return nil
+	})
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go func() {
+		reload(c)
+		close(done)
+	}()
+	c <- syscall.SIGHUP
+	close(c)
+	waitClosed(t, done, "reload")
+	if !reloaded {
+		t.Error("reload callback after the panicking one not called")
+	}
+	for _, msg := range []string{"OnReload callback panicked: reload", "Reload error: bad config"} {
+		if !logs.contains(msg) {
+			t.Errorf("%q not logged", msg)
+		}
+	}
+}
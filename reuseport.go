@@ -0,0 +1,55 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package seamless
+
+import (
+	"context"
+	"net"
+	"syscall"
+)
+
+// ListenReusePort announces on the local network address like net.Listen with
+// the SO_REUSEPORT socket option set. This option allows the new daemon to bind
+// the same address while the old daemon is still listening on it, allowing a
+// seamless transition from one process to the other. Note that the Go runtime
+// already sets SO_REUSEADDR on listening sockets.
+//
+// The semantics of SO_REUSEPORT differ across platforms:
+//
+//   - On Linux, the incoming connections are load balanced between the
+//     listeners bound to the address, which must belong to the same effective
+//     user. During the overlap, both daemons receive connections.
+//   - On FreeBSD, SO_REUSEPORT_LB is used when available (FreeBSD 12 and
+//     later) to get the Linux semantics. SO_REUSEPORT is used otherwise.
+//   - On macOS and the other BSDs, SO_REUSEPORT only allows the address to be
+//     bound several times, connections are not load balanced: a single
+//     listener receives them until it is closed.
+//
+// On all platforms, connections pending in the accept queue of a listener are
+// reset when it is closed: the old daemon should keep accepting until it
+// closed its listener, as http.Server.Shutdown does.
+//
+// The listener is watched across the restart, see WatchListener.
+func ListenReusePort(network, address string) (net.Listener, error) {
+	lc := net.ListenConfig{
+		Control: reusePortControl,
+	}
+	l, err := lc.Listen(context.Background(), network, address)
+	if err != nil {
+		return nil, err
+	}
+	WatchListener(l)
+	return l, nil
+}
+
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	var sysErr error
+	err := c.Control(func(fd uintptr) {
+		sysErr = setReusePort(int(fd))
+	})
+	if err != nil {
+		return err
+	}
+	return sysErr
+}
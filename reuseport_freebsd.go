@@ -0,0 +1,13 @@
+package seamless
+
+import "golang.org/x/sys/unix"
+
+// setReusePort sets SO_REUSEPORT_LB on fd so connections are load balanced
+// like on Linux, falling back to SO_REUSEPORT on FreeBSD versions without it.
+func setReusePort(fd int) error {
+	err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEPORT_LB, 1)
+	if err == unix.ENOPROTOOPT || err == unix.EINVAL {
+		err = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	}
+	return err
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package seamless
+
+import (
+	"errors"
+	"net"
+)
+
+// ErrReusePortUnsupported is returned by ListenReusePort on platforms not
+// supporting the SO_REUSEPORT socket option.
+var ErrReusePortUnsupported = errors.New("seamless: SO_REUSEPORT is not supported on this platform")
+
+// ListenReusePort is not supported on this platform and always returns
+// ErrReusePortUnsupported.
+func ListenReusePort(network, address string) (net.Listener, error) {
+	return nil, ErrReusePortUnsupported
+}
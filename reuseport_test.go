@@ -0,0 +1,35 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package seamless
+
+import (
+	"net"
+	"testing"
+)
+
+func TestListenReusePort(t *testing.T) {
+	resetForTest(t)
+	l1, err := ListenReusePort("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l1.Close()
+	// The new daemon binds the address of the old one.
+	l2, err := ListenReusePort("tcp", l1.Addr().String())
+	if err != nil {
+		t.Fatalf("second listener: %v", err)
+	}
+	defer l2.Close()
+	// Without SO_REUSEPORT, the address can't be bound twice.
+	if l, err := net.Listen("tcp", l1.Addr().String()); err == nil {
+		l.Close()
+		t.Error("address bound without SO_REUSEPORT")
+	}
+	l1.Close()
+	conn, err := net.Dial("tcp", l2.Addr().String())
+	if err != nil {
+		t.Fatalf("dial once the first listener is closed: %v", err)
+	}
+	conn.Close()
+}
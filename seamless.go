@@ -40,40 +40,118 @@
 // Seamless does not try to implement the actual graceful shutdown or to manage
 // sockets migration. This task is left to the caller. See the examples
 // directory for different implementations.
+//
+// Seamless restart relies on Unix signals. On Windows, the package compiles
+// but Init always disables seamless restart so the daemon runs as a single
+// process and Wait returns immediately.
 package seamless
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"net"
 	"os"
 	"os/signal"
 	"runtime"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
+// ShutdownReason tells why the graceful shutdown has been engaged.
+type ShutdownReason int
+
+const (
+	// ReasonSignal means the new daemon is started and notified the current
+	// one to shutdown.
+	ReasonSignal ShutdownReason = iota
+	// ReasonTimeout means no notification has been received from a new daemon
+	// within the self shutdown timeout (see SetSelfShutdownTimeout). The new
+	// daemon may not be running.
+	ReasonTimeout
+	// ReasonStop means the service is being stopped (see SetStopSignal) and
+	// no new daemon will be started.
+	ReasonStop
+)
+
+func (r ShutdownReason) String() string {
+	switch r {
+	case ReasonSignal:
+		return "signal"
+	case ReasonTimeout:
+		return "timeout"
+	case ReasonStop:
+		return "stop"
+	}
+	return "unknown"
+}
+
+// readyPollInterval is the interval at which StartedWhen polls its ready
+// predicate.
+const readyPollInterval = 100 * time.Millisecond
+
+// ErrAlreadyInitialized is returned by InitErr when seamless has already been
+// initialized.
+var ErrAlreadyInitialized = errors.New("seamless: already initialized")
+
+// ErrDisabled is returned by Restart when seamless is disabled.
+var ErrDisabled = errors.New("seamless: disabled")
+
+// ErrNotStarted is returned by Restart when called before Started.
+var ErrNotStarted = errors.New("seamless: not started")
+
+// ErrNotListening is returned by StartedAfterListen when the listener is not
+// bound or closed.
+var ErrNotListening = errors.New("seamless: listener not listening")
+
+// ErrNoLauncher is returned by Restart when seamless has been initialized
+// with InitNoLauncher.
+var ErrNoLauncher = errors.New("seamless: no launcher")
+
+// ErrNoRestart is returned by AbortRestart when no restart is in progress.
+var ErrNoRestart = errors.New("seamless: no restart in progress")
+
 var (
 	// LogMessage is used to log messages. The default implementation is to call
-	// log.Print with the message.
+	// the Info method of the Logger set with SetLogger.
 	LogMessage = func(msg string) {
-		log.Printf("seamless: %s", msg)
+		logger.Info(msg)
 	}
 
 	// LogError is used to log errors. The default implementation is to call
-	// log.Printf with the message followed by the error.
+	// the Error method of the Logger set with SetLogger. Message-only
+	// conditions should be logged with LogMessage, but err may be nil.
 	LogError = func(msg string, err error) {
-		log.Printf("seamless: %s: %v", msg, err)
+		logger.Error(msg, err)
 	}
 
-	inited               bool
-	disabled             bool
-	doneCh               chan struct{}
-	pidFilePath          string
-	parentTermSignal     = os.Signal(syscall.SIGCHLD)
-	onChildDaemonLaunch  []func()
-	shutdownRequestFuncs []func()
-	shutdownFuncs        []func()
+	forceDisabled       bool
+	supervised          bool
+	supervisorWarning   = true
+	pidFileMode         = os.FileMode(0644)
+	pidFileUID          = -1
+	pidFileGID          = -1
+	launcherPID         int
+	parentTermSignal    = os.Signal(sigChild)
+	termSignal          = os.Signal(syscall.SIGTERM)
+	stopSignal          os.Signal
+	handoffTimeout      = 10 * time.Second
+	termTimeout         time.Duration
+	requestTimeout      time.Duration
+	overlap             time.Duration
+	drainProgress       func() string
+	drainProgressEvery  time.Duration
+	beforeForkFuncs     []func()
+	onChildDaemonLaunch []func()
+	onChildLaunchFuncs  []func(pid int)
+	onChildTimeoutFuncs []func()
+	extraFiles          []*os.File
+	launchCustomizer    func(attr *os.ProcAttr, argv []string) ([]string, *os.ProcAttr)
+	// hooksMu protects the process-wide hooks.
+	hooksMu sync.Mutex
 )
 
 // Init initialize seamless. This method must be called as earliest as possible
@@ -83,170 +161,1043 @@ var (
 //
 // The pidFile is used for signaling between the new and old generation of the
 // daemon. If the pidFile is an empty string, seamless is disabled.
-func Init(pidFile string) {
-	if inited {
+//
+// The directory of the PID file (and of the control socket, see
+// UseControlSocket) must exist and be writable.
+//
+// The opts are applied before the initialization, as if the corresponding
+// setters had been called before Init:
+//
+//	seamless.Init("/run/app.pid",
+//		seamless.WithHandoffTimeout(30*time.Second),
+//		seamless.WithRestartSignal(syscall.SIGHUP))
+//
+// Init panics if called more than once. If the PID file directory is not
+// writable, the error is logged and seamless is disabled so the daemon runs
+// without seamless restart. See InitErr for a non panicking version.
+func Init(pidFile string, opts ...Option) {
+	if err := InitErr(pidFile, opts...); err == ErrAlreadyInitialized {
 		panic("seamless.Init already called")
 	}
-	doneCh = make(chan struct{})
-	inited = true
+}
+
+// InitErr is like Init but returns ErrAlreadyInitialized instead of panicking
+// if seamless has already been initialized. If the PID file directory is not
+// writable, the error is returned and seamless is disabled, so the caller may
+// decide to run without seamless restart.
+func InitErr(pidFile string, opts ...Option) error {
+	c := defaultController
+	if c.inited {
+		return ErrAlreadyInitialized
+	}
+	applyOptions(opts)
+	c.inited = true
 
 	if pidFile == "" {
-		disabled = true
-		return
+		c.disable()
+		return nil
+	}
+	c.pidFilePath = pidFile
+
+	if forceDisabled || os.Getenv("SEAMLESS_DISABLE") == "1" {
+		LogMessage("Seamless restart disabled")
+		c.disable()
+		return nil
+	}
+
+	if !launcherSupported {
+		LogMessage("Seamless restart is not supported on this platform")
+		c.disable()
+		return nil
+	}
+
+	if err := c.checkDirs(); err != nil {
+		LogError("Seamless restart disabled", err)
+		c.disable()
+		return err
 	}
-	pidFilePath = pidFile
 
-	if os.Getenv("SEAMLESS") != strconv.Itoa(os.Getppid()) {
+	detectInteractive()
+	if !launchedByLauncher(pidFile) {
+		if supervisorWarning && !supervised && parentIsShell() {
+			LogMessage("WARNING: started from a shell, seamless restart requires a supervisor to start the new daemon once the launcher exits")
+		}
 		LogMessage("Starting child process")
 		if err := os.Setenv("SEAMLESS", strconv.Itoa(os.Getpid())); err != nil {
 			LogError("Could set SEAMLESS environment variable", err)
 			// Disable the whole system. It should let the daemon to start anyway
 			// but with no seamless restart.
-			disabled = true
-			return
+			c.disable()
+			return nil
+		}
+		if err := writeLauncherNonce(pidFile); err != nil {
+			LogError("Could not write launcher nonce", err)
+			c.disable()
+			return nil
+		}
+		if supervised {
+			go supervise()
+		} else {
+			go launch()
 		}
-		go launch()
 		runtime.Goexit()
-		return
+		return nil
 	}
 
-	go stage1()
+	launcherPID = os.Getppid()
+	openLauncherAck()
+	ignoreTerminalInterrupt()
+	setProcTitle("")
+
+	// Register the USR2 handler synchronously so a signal sent by the launcher
+	// right after the start is not lost.
+	sigs := make(chan os.Signal, 1)
+	notifyShutdownRequest(sigs)
+	go c.stage1(sigs)
+	return nil
+}
+
+// notifyShutdownRequest registers c to receive the signals handled by stage1.
+func notifyShutdownRequest(c chan os.Signal) {
+	signal.Notify(c, sigShutdownRequest)
+	if stopSignal != nil || stopOnInterrupt {
+		// The launcher forwards stop requests as TERM.
+		signal.Notify(c, syscall.SIGTERM)
+	}
+}
+
+// Disable forces seamless to run in single process mode: Init does not start
+// the launcher and seamless restart is disabled, while the PID file path is
+// retained. The same can be achieved by setting the SEAMLESS_DISABLE
+// environment variable to 1. Disable must be called before Init.
+func Disable() {
+	if defaultController.inited {
+		panic("seamless.Disable must be called before seamless.Init")
+	}
+	forceDisabled = true
+}
+
+// DisableSupervisorWarning disables the warning logged by Init when the
+// program seems to run without a supervisor, i.e. when started from a shell.
+// Without a supervisor, nothing starts the new daemon once the launcher
+// exited on restart.
+func DisableSupervisorWarning() {
+	if defaultController.inited {
+		panic("seamless.DisableSupervisorWarning must be called before seamless.Init")
+	}
+	supervisorWarning = false
+}
+
+// IsLauncher reports whether the current process is the launcher generation
+// (see Init) rather than the actual daemon. It can be called before Init, in
+// which case it reports whether the process would become the launcher if
+// seamless restart is enabled.
+func IsLauncher() bool {
+	c := defaultController
+	if c.inited && (c.disabled || c.reexecMode || c.noLauncherMode) {
+		return false
+	}
+	return !launchedByLauncher(c.pidFilePath)
+}
+
+// Enabled reports whether seamless has been initialized with seamless restart
+// enabled.
+func Enabled() bool {
+	return defaultController.Enabled()
+}
+
+// PIDFilePath returns the path of the PID file passed to Init, or an empty
+// string if seamless restart is not enabled.
+func PIDFilePath() string {
+	return defaultController.PIDFilePath()
 }
 
 // Graceful shutdown stage 1
-func stage1() {
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGUSR2)
-	<-c
-	signal.Stop(c)
+func (c *Controller) stage1(sigs chan os.Signal) {
+	sig := <-sigs
+	signal.Stop(sigs)
+	if sig == syscall.SIGTERM {
+		// Stop requested by the launcher (see SetStopSignal): no new
+		// instance is coming, shutdown right away.
+		LogMessage("Stop requested")
+		c.shutdown(ReasonStop, c.termC())
+		return
+	}
+	requestedAt := clk.Now()
+	c.updateMetrics(func(m *Metrics) { m.Restarts++ })
 
+	c.setState(StateRequested)
 	LogMessage("Shutdown requested")
-	for _, f := range shutdownRequestFuncs {
-		f()
+	c.sdNotify("RELOADING=1")
+	// Watch for TERM from now on: the launcher sends it while the restart is
+	// in progress if the restart signal is repeated, and it must engage the
+	// graceful shutdown rather than kill the process.
+	term := c.termC()
+	c.hooksMu.Lock()
+	funcs := c.shutdownRequestFuncs
+	noShutdownFuncs := len(c.shutdownFuncs) == 0
+	c.hooksMu.Unlock()
+	if noShutdownFuncs {
+		// A common mistake is to shutdown the server in OnShutdownRequest,
+		// which stops serving before the new daemon is started.
+		LogMessage("WARNING: no OnShutdown callback registered, graceful shutdown must be performed in OnShutdown, not OnShutdownRequest")
+	}
+	callShutdownRequestFuncs(funcs)
+	c.checkListenersRequested()
+	if atomic.SwapInt32(&c.restartAborted, 0) == 1 {
+		LogMessage("Restart aborted")
+		signal.Stop(term)
+		c.setState(StateRunning)
+		c.sdNotify("READY=1")
+		notifyShutdownRequest(sigs)
+		go c.stage1(sigs)
+		notifyAbort()
+		return
 	}
 	// At this point, we are ready to inform our parent that it can start the
 	// new instance.
-	p, _ := os.FindProcess(os.Getppid())
-	if err := p.Signal(syscall.Signal(0)); err == nil {
-		if err = p.Signal(parentTermSignal); err != nil {
-			LogError(fmt.Sprintf("Could not send signal: %s to parent process", parentTermSignal.String()), err)
-		}
-	} else {
-		LogError("Could not find parent process", err)
+	notifyParent()
+
+	c.updateMetrics(func(m *Metrics) { m.HandoffDuration = clk.Now().Sub(requestedAt) })
+	c.setState(StateReady)
+	c.stage3(term)
+}
+
+// notifyParent signals the launcher that the daemon is ready for the new
+// instance to start. It is a variable so it can be replaced by the test
+// harness.
+var notifyParent = defaultNotifyParent
+
+func defaultNotifyParent() {
+	if !launcherAlive() {
 		// If our parent is dead already, the supervisor might still restart the
 		// process so we should be able to continue regardless.
+		LogMessage(fmt.Sprintf("Launcher process %d is gone, continuing restart", launcherPID))
+		return
+	}
+	ackHandoff()
+	p, _ := os.FindProcess(launcherPID)
+	if err := sendCriticalSignal(p, parentTermSignal); err != nil {
+		LogError(fmt.Sprintf("Could not send signal: %s to parent process", parentTermSignal.String()), err)
+		defaultController.updateMetrics(func(m *Metrics) { m.SignalFailures++ })
+	}
+}
+
+// notifyAbort signals the launcher that the restart has been aborted (see
+// AbortRestart). It is a variable so it can be replaced by the test harness.
+var notifyAbort = defaultNotifyAbort
+
+func defaultNotifyAbort() {
+	if !launcherAlive() {
+		return
+	}
+	p, _ := os.FindProcess(launcherPID)
+	if err := p.Signal(sigShutdownRequest); err != nil {
+		LogError("Could not notify the launcher of the restart abort", err)
 	}
+}
 
-	stage3()
+// AbortRestart aborts the restart in progress. It must be called from an
+// OnShutdownRequest callback, for instance when some pre-handoff check fails:
+// once the callbacks returned, the launcher is not notified, the daemon goes
+// back to StateRunning and keeps serving as if no restart was requested.
+//
+// The abort only works before the launcher has been notified, ErrNoRestart is
+// returned if no restart is in progress or if it is too late to abort it. The
+// launcher is told to cancel the handoff with a USR2 signal and stays attached
+// to the supervisor. Note that the supervisor's stop request is thus ignored,
+// and that a USR2 signal sent to the launcher during the handoff is taken as an
+// abort.
+func AbortRestart() error {
+	return defaultController.AbortRestart()
+}
+
+// AbortRestart is like the package level AbortRestart function, operating on
+// c.
+func (c *Controller) AbortRestart() error {
+	if c.CurrentState() != StateRequested {
+		return ErrNoRestart
+	}
+	atomic.StoreInt32(&c.restartAborted, 1)
+	return nil
+}
+
+// launcherAlive reports whether the launcher is still the parent of the
+// current process. When the launcher dies, the daemon is reparented (to init
+// or to a subreaper) and its parent PID changes.
+func launcherAlive() bool {
+	return os.Getppid() == launcherPID
+}
+
+// callShutdownRequestFuncs calls the OnShutdownRequest callbacks funcs in
+// order, giving up on them once the shutdown request timeout is reached (see
+// SetShutdownRequestTimeout).
+func callShutdownRequestFuncs(funcs []func()) {
+	if requestTimeout <= 0 {
+		for _, f := range funcs {
+			callSafe("OnShutdownRequest", f)
+		}
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, f := range funcs {
+			callSafe("OnShutdownRequest", f)
+		}
+	}()
+	select {
+	case <-done:
+	case <-clk.After(requestTimeout):
+		LogMessage(fmt.Sprintf("WARNING: OnShutdownRequest callbacks did not return within %s, proceeding with the restart", requestTimeout))
+	}
+}
+
+// callSafe calls f, recovering and logging any panic so the restart process
+// can continue.
+func callSafe(name string, f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			LogError(name+" callback panicked", fmt.Errorf("%v", r))
+		}
+	}()
+	f()
 }
 
 // Started must be called as soon as the server is started and ready to serve.
 // This mean that this method must be called after a successful listen. This can
 // be challenging as a listen call is blocking. See examples directory to see
 // how to do that.
+//
+// Only the first call to Started has an effect. Concurrent calls block until
+// the first one completes.
+//
+// If another new process is coordinating a handoff at the same time, like in
+// a supervisor restart loop, Started backs off: an error is logged, the PID
+// file is left to the other process and no old process is notified.
 func Started() {
-	if !inited {
+	defaultController.Started()
+}
+
+// Started is like the package level Started function, operating on c.
+func (c *Controller) Started() {
+	if !c.inited {
 		panic("called seamless.Start before seamless.Init")
 	}
 
-	if disabled {
+	if c.disabled {
 		return
 	}
 
-	defer func() {
-		if err := os.WriteFile(pidFilePath, []byte(fmt.Sprintf("%d", os.Getpid())), 0644); err != nil {
-			LogError("Could not create PID file", err)
+	c.startedOnce.Do(c.notifyStarted)
+}
+
+// notifyStarted notifies the old process and writes the PID file.
+func (c *Controller) notifyStarted() {
+	atomic.StoreInt32(&c.started, 1)
+	c.sdNotify("READY=1")
+
+	// This is stage 2 on the other (new) process. The old PID file must be
+	// read before being replaced by ours, while holding the lock so no other
+	// new process coordinates a handoff at the same time.
+	unlock, ok := lockPIDFile(c.pidFilePath)
+	if !ok {
+		LogError("Not notifying old process", errors.New("another restart is in progress"))
+		return
+	}
+	old, found := readOldPIDFile(c.pidFilePath)
+	if err := writePIDFile(c.pidFilePath, currentPIDFileInfo()); err != nil {
+		LogError("Could not create PID file", err)
+	} else {
+		c.hooksMu.Lock()
+		funcs := c.pidFileWrittenFuncs
+		c.hooksMu.Unlock()
+		for _, f := range funcs {
+			f(c.pidFilePath)
 		}
-	}()
+	}
+	var listed time.Time
+	if trackPredecessors {
+		listed = modTime(c.generationsPath())
+		c.addGeneration(old, found)
+	}
+	// notify must be called with the PID file lock held.
+	notify := func() {
+		if controlPath != "" && c.isDefault() {
+			notified := notifyControl()
+			listenControl()
+			if notified {
+				return
+			}
+		}
+		if trackPredecessors {
+			c.notifyPredecessors(old, listed)
+			return
+		}
+		if found {
+			c.notifyOld(old)
+		}
+	}
+	if overlap > 0 {
+		unlock()
+		LogMessage(fmt.Sprintf("Notifying old process in %s", overlap))
+		go func() {
+			<-clk.After(overlap)
+			// Our PID file is written already, so a newer process holding
+			// the lock coordinates its own handoff with us: notify our
+			// predecessor regardless.
+			unlock, _ := lockPIDFile(c.pidFilePath)
+			notify()
+			unlock()
+		}()
+	} else {
+		notify()
+		unlock()
+	}
+	c.createReadinessFile()
+	c.notifyReadyFD()
+
+	c.hooksMu.Lock()
+	funcs := c.startedFuncs
+	c.hooksMu.Unlock()
+	for _, f := range funcs {
+		callSafe("OnStarted", f)
+	}
+}
 
-	// This is stage 2 on the other (new) process.
-	b, err := os.ReadFile(pidFilePath)
+// readOldPIDFile reads the PID file at path left by the old process. It
+// returns false if there is no valid PID file, in which case the file is
+// overwritten by the PID file of the current process.
+func readOldPIDFile(path string) (pidFileInfo, bool) {
+	b, err := readPIDFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// No pid file = no old process to notify.
-			return
+			return pidFileInfo{}, false
 		}
 		LogError("Notification error", fmt.Errorf("cannot read PID file: %v", err))
-		return
+		return pidFileInfo{}, false
 	}
-	LogMessage("Notifying old process")
-	if err := os.Remove(pidFilePath); err != nil {
-		LogError("Could not remove old PID file", err)
-	}
-	var pid int
-	if _, err := fmt.Sscanf(string(b), "%d", &pid); err != nil {
+	info, err := parsePIDFile(b)
+	if err != nil {
 		LogError("Notification error", fmt.Errorf("invalid PID file content: %v", err))
+		return pidFileInfo{}, false
+	}
+	info.Written = modTime(path)
+	return info, true
+}
+
+// notifyOld sends a TERM signal to the old process described by info.
+func (c *Controller) notifyOld(info pidFileInfo) {
+	pid := info.PID
+	if pid == os.Getpid() {
+		// PIDs are commonly reused across container restarts: a PID file
+		// left by a previous container may hold our own PID.
+		LogMessage(fmt.Sprintf("Ignoring stale PID file (process %d is the current process)", pid))
 		return
 	}
 	p, _ := os.FindProcess(pid)
-	if err := p.Signal(syscall.Signal(0)); err == nil {
-		if err = p.Signal(syscall.SIGTERM); err != nil {
-			LogError("Could not send SIGTERM to old process", err)
+	if !processAlive(pid) {
+		// The old process is gone without removing its PID file (crash),
+		// there is nobody to notify.
+		LogMessage(fmt.Sprintf("Ignoring stale PID file (process %d not found)", pid))
+		return
+	}
+	if !isSeamlessProcess(info) {
+		LogError("Not notifying old process", fmt.Errorf("process %d is not a seamless daemon", pid))
+		return
+	}
+	LogMessage(fmt.Sprintf("Notifying old process (%s)", info))
+	if err := sendCriticalSignal(p, termSignal); err != nil {
+		LogError(fmt.Sprintf("Could not send %s signal to old process, both processes keep serving", termSignal), err)
+		c.updateMetrics(func(m *Metrics) { m.SignalFailures++ })
+	}
+}
+
+const (
+	// signalAttempts is the maximum number of attempts to send a critical
+	// signal.
+	signalAttempts = 3
+	// signalRetryDelay is the delay between two attempts to send a critical
+	// signal.
+	signalRetryDelay = 100 * time.Millisecond
+)
+
+// signalProcess sends sig to p. It is a variable so it can be replaced in
+// tests.
+var signalProcess = func(p *os.Process, sig os.Signal) error {
+	return p.Signal(sig)
+}
+
+// sendCriticalSignal sends sig to p, retrying on transient errors (EINTR,
+// EAGAIN). It is used for the signals driving the restart, which must not be
+// lost.
+func sendCriticalSignal(p *os.Process, sig os.Signal) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = signalProcess(p, sig)
+		if err == nil || attempt == signalAttempts ||
+			!(errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN)) {
+			return err
 		}
-	} else {
-		LogError("Could not find old process", err)
+		LogError(fmt.Sprintf("Could not send %s signal, retrying", sig), err)
+		<-clk.After(signalRetryDelay)
+	}
+}
+
+// StartedAfterListen is like Started but first checks that l is a bound and
+// open listener. If not, ErrNotListening is returned and the old process is
+// not notified, so it keeps serving.
+//
+// The listener is watched across the restart, see WatchListener.
+func StartedAfterListen(l net.Listener) error {
+	if err := listenerErr(l); err != nil {
+		return err
 	}
+	WatchListener(l)
+	Started()
+	return nil
 }
 
-func stage3() {
+// StartedWhen is like Started but waits for ready to return true before
+// notifying the old process. The ready predicate is polled until it returns
+// true or timeout elapses. If the timeout elapses first, an error is logged and
+// Started is not called, so the old process keeps serving.
+func StartedWhen(ready func() bool, timeout time.Duration) {
+	deadline := clk.Now().Add(timeout)
+	for !ready() {
+		if clk.Now().After(deadline) {
+			LogError("Not notifying old process", fmt.Errorf("not ready after %s", timeout))
+			return
+		}
+		<-clk.After(readyPollInterval)
+	}
+	Started()
+}
+
+// Restart triggers a seamless restart from within the daemon, as if the
+// supervisor had sent the restart signal (see SetRestartSignal) to the
+// launcher: the first restart signal which does not stop the service (see
+// SetStopSignal) is sent. The launcher is asked to initiate the restart
+// sequence, so it must still be alive for Restart to succeed.
+//
+// Restart returns ErrNotStarted if Started has not been called yet,
+// ErrDisabled if seamless is disabled and ErrNoLauncher if seamless has been
+// initialized with InitNoLauncher.
+func Restart() error {
+	c := defaultController
+	if !c.inited {
+		panic("called seamless.Restart before seamless.Init")
+	}
+	if c.disabled {
+		return ErrDisabled
+	}
+	if atomic.LoadInt32(&c.started) == 0 {
+		return ErrNotStarted
+	}
+	if c.noLauncherMode {
+		return ErrNoLauncher
+	}
+	if !launcherAlive() {
+		return fmt.Errorf("launcher process %d is gone", launcherPID)
+	}
+	sig := restartTrigger()
+	if sig == nil {
+		return errors.New("no restart signal distinct from the stop signal")
+	}
+	p, _ := os.FindProcess(launcherPID)
+	if err := p.Signal(sig); err != nil {
+		return fmt.Errorf("cannot signal launcher process: %v", err)
+	}
+	return nil
+}
+
+// notifyTerm returns a channel receiving the TERM signal (see SetTermSignal)
+// sent by the new daemon. It is a variable so it can be replaced by the test
+// harness.
+var notifyTerm = defaultNotifyTerm
+
+func defaultNotifyTerm() chan os.Signal {
+	signal.Reset(termSignal)
+	return notifyTermShared()
+}
+
+// notifyTermShared returns a channel receiving the TERM signal without
+// resetting the other TERM handlers.
+func notifyTermShared() chan os.Signal {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, termSignal)
+	return c
+}
+
+func (c *Controller) stage3(term chan os.Signal) {
 	// We are waiting for a TERM signal to more to the next stage (stage 3).
 	LogMessage("Ready, waiting for TERM signal")
 
-	signal.Reset(syscall.SIGTERM)
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGTERM)
+	var timeout <-chan time.Time // never firing if no termTimeout
+	if termTimeout > 0 {
+		timeout = clk.After(termTimeout)
+	}
+	reason := ReasonSignal
 	select {
-	case <-c:
-	case <-time.After(10 * time.Second):
-		// Trigger stage3 if no TERM received within 10 seconds.
+	case <-term:
+	case <-c.controlC():
+	case <-timeout:
+		// Trigger stage3 if no TERM received within the self shutdown
+		// timeout.
+		reason = ReasonTimeout
 	}
-	signal.Stop(c)
+	c.shutdown(reason, term)
+}
 
+// shutdown performs the graceful shutdown. A TERM signal received on term
+// while the shutdown callbacks run cancels their context: the operator wants
+// the daemon gone now. The term channel is stopped once the graceful shutdown
+// is completed.
+func (c *Controller) shutdown(reason ShutdownReason, term chan os.Signal) {
+	shutdownAt := clk.Now()
+
+	c.setState(StateShutdown)
 	LogMessage("Graceful shutdown started")
-	for _, f := range shutdownFuncs {
-		f()
+	c.sdNotify("STOPPING=1")
+	c.removeReadinessFile()
+	if c.isDefault() {
+		setProcTitle("draining")
+	}
+	c.hooksMu.Lock()
+	drainStartFuncs := c.drainStartFuncs
+	funcs := c.sortedShutdownFuncs()
+	c.hooksMu.Unlock()
+	for _, f := range drainStartFuncs {
+		callSafe("OnDrainStart", func() {
+			if err := f(); err != nil {
+				LogError("OnDrainStart callback failed", err)
+			}
+		})
+	}
+	ctx, cancel := shutdownContext(shutdownAt)
+	go func() {
+		select {
+		case <-term:
+			LogMessage("TERM signal received during graceful shutdown, cancelling the drain")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	stopProgress := reportDrainProgress()
+	for _, f := range funcs {
+		callSafe("OnShutdown", func() { f.f(ctx, reason) })
+	}
+	if n := c.workers.Count(); n > 0 {
+		LogMessage(fmt.Sprintf("Waiting for %d workers", n))
+		if err := c.workers.Wait(ctx); err != nil {
+			LogError(fmt.Sprintf("%d workers still running", c.workers.Count()), err)
+		}
+	}
+	stopProgress()
+	c.checkListenersShutdown()
+	if ctx.Err() != nil {
+		c.MarkShutdownDegraded()
+	}
+	cancel()
+	signal.Stop(term)
+	if c.isDefault() {
+		removeUnixSockets()
+	}
+	degraded := atomic.LoadInt32(&c.degraded) == 1
+	if degraded {
+		LogMessage("Graceful shutdown completed (degraded)")
+	} else {
+		LogMessage("Graceful shutdown completed")
+	}
+	c.updateMetrics(func(m *Metrics) {
+		m.ShutdownDuration = clk.Now().Sub(shutdownAt)
+		m.ShutdownTimedOut = reason == ReasonTimeout
+		m.ShutdownDegraded = degraded
+	})
+	if degraded {
+		c.hooksMu.Lock()
+		degradedFuncs := c.degradedFuncs
+		c.hooksMu.Unlock()
+		for _, f := range degradedFuncs {
+			callSafe("OnDegradedShutdown", f)
+		}
 	}
-	LogMessage("Graceful shutdown completed")
-	close(doneCh)
+	c.setState(StateDone)
+	c.hooksMu.Lock()
+	exitFuncs := c.onExitFuncs
+	c.hooksMu.Unlock()
+	for _, f := range exitFuncs {
+		callSafe("OnExit", f)
+	}
+	close(c.doneCh)
+}
+
+// OnStarted set f to be called at the end of Started, once the PID file is
+// written and the old process notified (or scheduled to be, see SetOverlap).
+// It is not called when seamless is disabled.
+func OnStarted(f func()) {
+	defaultController.OnStarted(f)
+}
+
+// OnStarted is like the package level OnStarted function, operating on c.
+func (c *Controller) OnStarted(f func()) {
+	c.hooksMu.Lock()
+	defer c.hooksMu.Unlock()
+	c.startedFuncs = append(c.startedFuncs, f)
+}
+
+// OnPIDFileWritten set f to be called by Started right after the PID file has
+// been successfully written, with the path of the PID file. It is called
+// before the old process is notified, and not called if the PID file could not
+// be written. f is called while holding the PID file lock and should not
+// block.
+func OnPIDFileWritten(f func(path string)) {
+	defaultController.OnPIDFileWritten(f)
 }
 
-// OnShutdownRequest set f to be called when a graceful shutdown is requested.
-// This callback is optional and can be use to release some non-production
-// resources that need to be release in order for the new daemon to start
-// correctly.
+// OnPIDFileWritten is like the package level OnPIDFileWritten function,
+// operating on c.
+func (c *Controller) OnPIDFileWritten(f func(path string)) {
+	c.hooksMu.Lock()
+	defer c.hooksMu.Unlock()
+	c.pidFileWrittenFuncs = append(c.pidFileWrittenFuncs, f)
+}
+
+// OnShutdownRequest set f to be called when a graceful shutdown is requested
+// (stage 1, when the daemon receives USR2 from the launcher). This callback is
+// optional and can be use to release some non-production resources that need
+// to be release in order for the new daemon to start correctly.
+//
+// At this stage, the new daemon is not started yet and the current daemon must
+// keep serving: listeners must not be closed and the actual graceful shutdown
+// must not be initiated. See OnShutdown for that. The restart waits for the
+// callbacks to return, see SetShutdownRequestTimeout to bound this wait.
 //
-// The actual graceful shutdown should not be initiated at this stage. See
-// OnShutdown for that.
+// OnShutdownRequest may be called before or after Init. If the shutdown has
+// already been requested, f is never called and a warning is logged.
 func OnShutdownRequest(f func()) {
-	shutdownRequestFuncs = append(shutdownRequestFuncs, f)
+	defaultController.OnShutdownRequest(f)
+}
+
+// OnShutdownRequest is like the package level OnShutdownRequest function,
+// operating on c.
+func (c *Controller) OnShutdownRequest(f func()) {
+	c.hooksMu.Lock()
+	defer c.hooksMu.Unlock()
+	if c.CurrentState() >= StateRequested {
+		LogMessage("OnShutdownRequest called after shutdown was requested, callback ignored")
+		return
+	}
+	c.shutdownRequestFuncs = append(c.shutdownRequestFuncs, f)
 }
 
-// OnShutdown set f to be called when the graceful shutdown is engaged. When f
+// OnShutdown set f to be called when the graceful shutdown is engaged (stage 3,
+// once the new daemon is started and sent TERM to the current one). This is
+// where listeners should be closed and in-flight requests drained. When f
 // returns, the graceful shutdown is considered done, and seamless.Wait will
 // unblock.
+//
+// OnShutdown may be called before or after Init. If the graceful shutdown has
+// already been engaged, f is never called and a warning is logged.
+//
+// OnShutdown callbacks are part of the shutdown phase 0, see OnShutdownPhase.
 func OnShutdown(f func()) {
-	shutdownFuncs = append(shutdownFuncs, f)
+	defaultController.OnShutdown(f)
+}
+
+// OnShutdown is like the package level OnShutdown function, operating on c.
+func (c *Controller) OnShutdown(f func()) {
+	c.OnShutdownReason(func(ShutdownReason) { f() })
+}
+
+// OnShutdownReason is like OnShutdown but f receives the reason why the
+// graceful shutdown has been engaged.
+func OnShutdownReason(f func(reason ShutdownReason)) {
+	defaultController.OnShutdownReason(f)
+}
+
+// OnShutdownReason is like the package level OnShutdownReason function,
+// operating on c.
+func (c *Controller) OnShutdownReason(f func(reason ShutdownReason)) {
+	c.addShutdownFunc(0, func(_ context.Context, reason ShutdownReason) { f(reason) })
+}
+
+// OnExit set f to be called as the very last step of the seamless restart in
+// the old process: after the OnShutdown callbacks returned and right before
+// Wait unblocks. Seamless never calls os.Exit itself in the daemon, exiting is
+// left to the caller once Wait returned.
+func OnExit(f func()) {
+	defaultController.OnExit(f)
+}
+
+// OnExit is like the package level OnExit function, operating on c.
+func (c *Controller) OnExit(f func()) {
+	c.hooksMu.Lock()
+	defer c.hooksMu.Unlock()
+	c.onExitFuncs = append(c.onExitFuncs, f)
+}
+
+// BeforeFork executes f() in the launcher just before the child process is
+// started. f() is only called in the launcher process and should not be
+// blocking. It must be registered before Init.
+func BeforeFork(f func()) {
+	beforeForkFuncs = append(beforeForkFuncs, f)
 }
 
 // OnChildDaemonLaunch executes f() after successful launch of the child process
-// by the launcher. f() should not be blocking.
+// by the launcher. f() is only called in the launcher process and should not be
+// blocking. It must be registered before Init.
 // Typical use case include resource cleanups, logging etc.
 func OnChildDaemonLaunch(f func()) {
 	onChildDaemonLaunch = append(onChildDaemonLaunch, f)
 }
 
+// OnChildLaunch is like OnChildDaemonLaunch but f receives the PID of the
+// child process started by the launcher.
+func OnChildLaunch(f func(pid int)) {
+	onChildLaunchFuncs = append(onChildLaunchFuncs, f)
+}
+
+// OnChildTimeout executes f() in the launcher when the child did not signal
+// back within the handoff timeout (see SetHandoffTimeout), just before the
+// child is sent a TERM signal. This indicates a daemon not able to prepare for
+// the restart. f() is only called in the launcher process and should not be
+// blocking. It must be registered before Init.
+func OnChildTimeout(f func()) {
+	onChildTimeoutFuncs = append(onChildTimeoutFuncs, f)
+}
+
+// SetExtraFiles sets additional open files to be inherited by the child
+// process started by the launcher, like exec.Cmd.ExtraFiles. Entry i becomes
+// file descriptor 3+i in the child. When socket activation file descriptors
+// are forwarded (see InheritListeners), they come first and extra files start
+// at 3+LISTEN_FDS.
+func SetExtraFiles(files ...*os.File) {
+	if defaultController.inited {
+		panic("seamless.SetExtraFiles must be called before seamless.Init")
+	}
+	extraFiles = files
+}
+
+// SetLaunchCustomizer sets f to customize the arguments and process attributes
+// used by the launcher to start the child process. The default is to start the
+// child with the same arguments and environment as the launcher. A nil argv
+// or attr returned by f keeps the one passed to f. If f sets an explicit
+// environment, the SEAMLESS, SEAMLESS_NONCE and SEAMLESS_ACK_FD environment
+// variables are set on it so the child still recognizes its launcher. The
+// files in attr must be kept, as the handoff acknowledgment pipe is passed to
+// the child as the last one.
+func SetLaunchCustomizer(f func(attr *os.ProcAttr, argv []string) ([]string, *os.ProcAttr)) {
+	if defaultController.inited {
+		panic("seamless.SetLaunchCustomizer must be called before seamless.Init")
+	}
+	launchCustomizer = f
+}
+
 // SetParentTermSignal allows user to define signal to send to the parent process
 // to trigger shutdown of the parent (launcher) process.
 // By default seamless sends SIGCHLD to the parent.
+//
+// As any child of the launcher generates a CHLD signal, the daemon also
+// acknowledges the handoff through a pipe inherited from the launcher, and a
+// CHLD signal without acknowledgment is ignored. Any other signal set here
+// is trusted as is.
 func SetParentTermSignal(sig os.Signal) {
-	if inited {
+	if defaultController.inited {
 		panic("seamless.SetParentTermSignal must be called before seamless.Init")
 	}
 	parentTermSignal = sig
 }
 
+// SetTermSignal sets the signal sent by the new daemon to the old one to engage
+// its graceful shutdown, and thus the signal the daemon waits for once a
+// restart is requested. The launcher also sends it to the daemon when the
+// handoff times out. Use it when the daemon reserves TERM for another purpose,
+// for instance SIGQUIT to mimic nginx. The default is SIGTERM.
+func SetTermSignal(sig os.Signal) {
+	if defaultController.inited {
+		panic("seamless.SetTermSignal must be called before seamless.Init")
+	}
+	termSignal = sig
+}
+
+// SetPIDFileMode sets the permissions of the PID file. The default is 0644.
+func SetPIDFileMode(mode os.FileMode) {
+	if defaultController.inited {
+		panic("seamless.SetPIDFileMode must be called before seamless.Init")
+	}
+	pidFileMode = mode
+}
+
+// SetPIDFileOwner sets the owner and group of the PID file. A uid or gid of -1
+// leaves it unchanged. Changing the ownership is best effort: a failure is
+// logged but does not prevent the PID file from being written.
+func SetPIDFileOwner(uid, gid int) {
+	if defaultController.inited {
+		panic("seamless.SetPIDFileOwner must be called before seamless.Init")
+	}
+	pidFileUID = uid
+	pidFileGID = gid
+}
+
+// SetHandoffTimeout sets the maximum duration the launcher waits for the
+// daemon to signal back (see SetParentTermSignal) after a restart has been
+// requested. Once this timeout is reached, the launcher sends the TERM signal
+// (see SetTermSignal) to the daemon, engaging its graceful shutdown, and keeps
+// waiting for it: the launcher exits with a status matching the daemon's once
+// the daemon exited. The default is 10 seconds.
+func SetHandoffTimeout(d time.Duration) {
+	if defaultController.inited {
+		panic("seamless.SetHandoffTimeout must be called before seamless.Init")
+	}
+	handoffTimeout = d
+}
+
+// SetSelfShutdownTimeout opts into a safety timeout after which the old daemon
+// engages its graceful shutdown by itself if it did not receive the TERM
+// signal sent by the new daemon (see Started) once it signaled the launcher.
+//
+// By default, the old daemon waits for the TERM signal indefinitely: the new
+// daemon sends it once healthy, so the old daemon keeps serving if the new one
+// fails to start. With a self shutdown timeout, a new daemon failing to start
+// (or taking longer than d to call Started) means no daemon is serving any
+// more, i.e. downtime. Only enable it if a lingering old daemon is worse than
+// an outage, and pick d well above the start duration of the daemon. The
+// shutdown reason is then ReasonTimeout.
+func SetSelfShutdownTimeout(d time.Duration) {
+	if defaultController.inited {
+		panic("seamless.SetSelfShutdownTimeout must be called before seamless.Init")
+	}
+	termTimeout = d
+}
+
+// SetShutdownRequestTimeout bounds the duration of the OnShutdownRequest
+// callbacks. If they did not return within d, a warning is logged and the
+// restart proceeds as if they had: the launcher is notified so the new daemon
+// can start instead of the launcher timing out (see SetHandoffTimeout) and
+// killing the daemon. The callbacks still running are left behind. The
+// default is 0, which waits for the callbacks indefinitely.
+func SetShutdownRequestTimeout(d time.Duration) {
+	if defaultController.inited {
+		panic("seamless.SetShutdownRequestTimeout must be called before seamless.Init")
+	}
+	requestTimeout = d
+}
+
+// SetTermTimeout is the former name of SetSelfShutdownTimeout.
+//
+// Deprecated: use SetSelfShutdownTimeout, which documents the downtime risk.
+func SetTermTimeout(d time.Duration) {
+	if defaultController.inited {
+		panic("seamless.SetTermTimeout must be called before seamless.Init")
+	}
+	termTimeout = d
+}
+
+// SetOverlap delays the notification of the old process by Started for d, so
+// both the old and the new process serve during d, for instance to let the new
+// process warm its caches under real traffic. This requires both processes to
+// be able to listen at the same time (see ListenReusePort). The PID file is
+// written immediately and Started does not block during the overlap.
+func SetOverlap(d time.Duration) {
+	if defaultController.inited {
+		panic("seamless.SetOverlap must be called before seamless.Init")
+	}
+	overlap = d
+}
+
+// SetDrainProgress sets progress to be called every interval while the
+// OnShutdown callbacks are running. The returned status is logged, so long
+// graceful shutdowns report their progress, like the number of remaining
+// connections.
+func SetDrainProgress(progress func() string, interval time.Duration) {
+	if defaultController.inited {
+		panic("seamless.SetDrainProgress must be called before seamless.Init")
+	}
+	drainProgress = progress
+	drainProgressEvery = interval
+}
+
+// reportDrainProgress starts logging the drain progress if configured. The
+// returned function stops the reporting.
+func reportDrainProgress() (stop func()) {
+	if drainProgress == nil || drainProgressEvery <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-clk.After(drainProgressEvery):
+				LogMessage("Graceful shutdown in progress: " + drainProgress())
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// SetStopSignal sets the signal the launcher watches for to stop the service
+// without restart. When the launcher receives this signal, it sends a TERM
+// signal to the daemon, which engages its graceful shutdown right away with
+// ReasonStop, without handoff. The launcher then exits once the daemon exited.
+// By default, no stop signal is set and every TERM or INT signal triggers a
+// restart, except INT when the launcher runs in a terminal (see
+// SetRestartSignal). The stop signal takes precedence over the restart
+// signals, so SetStopSignal(syscall.SIGINT) makes Ctrl-C stop the service.
+func SetStopSignal(sig os.Signal) {
+	if defaultController.inited {
+		panic("seamless.SetStopSignal must be called before seamless.Init")
+	}
+	stopSignal = sig
+}
+
 // Wait blocks until the seamless restart is completed. This method should be
-// called at the end of the main function.
+// called at the end of the main function. If seamless is disabled, Wait returns
+// immediately.
+//
+// Seamless does not exit the daemon process: the caller is expected to return
+// from main (or call os.Exit) once Wait returned. See OnExit for a hook called
+// right before Wait unblocks.
 func Wait() {
-	<-doneCh
+	defaultController.Wait()
+}
+
+// Wait is like the package level Wait function, operating on c.
+func (c *Controller) Wait() {
+	_ = c.WaitContext(context.Background())
+}
+
+// Done returns a channel closed once the seamless restart is completed, or
+// when seamless is disabled. It may be called before Init.
+func Done() <-chan struct{} {
+	return defaultController.Done()
+}
+
+// Done is like the package level Done function, operating on c.
+func (c *Controller) Done() <-chan struct{} {
+	return c.doneCh
+}
+
+// WaitContext is like Wait but returns ctx.Err() if ctx is done before the
+// seamless restart is completed.
+func WaitContext(ctx context.Context) error {
+	return defaultController.WaitContext(ctx)
+}
+
+// WaitContext is like the package level WaitContext function, operating on c.
+func (c *Controller) WaitContext(ctx context.Context) error {
+	select {
+	case <-c.doneCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,636 @@
+package seamless
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// testTimeout bounds the waits of the tests on asynchronous events.
+const testTimeout = 5 * time.Second
+
+// resetForTest resets seamless before and after the test.
+func resetForTest(t *testing.T) {
+	t.Helper()
+	Reset()
+	t.Cleanup(Reset)
+}
+
+// logRecorder records the messages logged with LogMessage and LogError.
+type logRecorder struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+// recordLogs captures the logs until the end of the test.
+func recordLogs(t *testing.T) *logRecorder {
+	r := &logRecorder{}
+	logMessage, logError := LogMessage, LogError
+	LogMessage = r.add
+	LogError = func(msg string, err error) {
+		if err != nil {
+			msg += ": " + err.Error()
+		}
+		r.add(msg)
+	}
+	t.Cleanup(func() {
+		LogMessage, LogError = logMessage, logError
+	})
+	return r
+}
+
+func (r *logRecorder) add(msg string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines = append(r.lines, msg)
+}
+
+// contains reports whether a recorded line contains substr.
+func (r *logRecorder) contains(substr string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, l := range r.lines {
+		if strings.Contains(l, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// setLauncherEnv makes the current process look like a daemon started by a
+// launcher, its parent, so InitErr takes the daemon path with pidFile.
+func setLauncherEnv(t *testing.T, pidFile string) {
+	t.Helper()
+	t.Setenv("SEAMLESS", strconv.Itoa(os.Getppid()))
+	t.Setenv("SEAMLESS_NONCE", "test")
+	if err := os.WriteFile(launcherNoncePath(pidFile, os.Getppid()), []byte("test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// signalRecorder records the signals sent with signalProcess.
+type signalRecorder struct {
+	mu   sync.Mutex
+	sent []sentSignal
+}
+
+type sentSignal struct {
+	pid int
+	sig os.Signal
+}
+
+// recordSignals replaces signalProcess until the end of the test, recording
+// the signals instead of sending them.
+func recordSignals(t *testing.T) *signalRecorder {
+	r := &signalRecorder{}
+	orig := signalProcess
+	signalProcess = func(p *os.Process, sig os.Signal) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.sent = append(r.sent, sentSignal{pid: p.Pid, sig: sig})
+		return nil
+	}
+	t.Cleanup(func() {
+		signalProcess = orig
+	})
+	return r
+}
+
+// signals returns the recorded signals.
+func (r *signalRecorder) signals() []sentSignal {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]sentSignal(nil), r.sent...)
+}
+
+// waitClosed fails the test if ch is not closed within testTimeout.
+func waitClosed(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(testTimeout):
+		t.Fatalf("%s: timeout", what)
+	}
+}
+
+// testDaemon drives the restart stages of the default controller in-process,
+// like the seamlesstest harness which can't be used from this package.
+type testDaemon struct {
+	shutdownRequest chan os.Signal
+	term            chan os.Signal
+	parent          chan struct{}
+}
+
+// newTestDaemon resets seamless and initializes it as a daemon started by the
+// launcher, with pidFile as the PID file.
+func newTestDaemon(t *testing.T, pidFile string) *testDaemon {
+	t.Helper()
+	resetForTest(t)
+	return initTestDaemon(t, pidFile)
+}
+
+// initTestDaemon is like newTestDaemon without resetting seamless first, so
+// callbacks can be registered before the initialization.
+func initTestDaemon(t *testing.T, pidFile string) *testDaemon {
+	t.Helper()
+	d := &testDaemon{
+		shutdownRequest: make(chan os.Signal, 1),
+		term:            make(chan os.Signal, 1),
+		parent:          make(chan struct{}, 1),
+	}
+	if err := initHarness(pidFile, d.shutdownRequest, d.term, func() {
+		d.parent <- struct{}{}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// requestShutdown simulates the shutdown request of the launcher and waits
+// for the launcher to be notified.
+func (d *testDaemon) requestShutdown(t *testing.T) {
+	t.Helper()
+	d.shutdownRequest <- sigShutdownRequest
+	select {
+	case <-d.parent:
+	case <-time.After(testTimeout):
+		t.Fatal("launcher not notified")
+	}
+}
+
+// terminate simulates the TERM signal of the new daemon and waits for the
+// graceful shutdown to complete.
+func (d *testDaemon) terminate(t *testing.T) {
+	t.Helper()
+	d.term <- syscall.SIGTERM
+	waitClosed(t, Done(), "Wait")
+}
+
+func TestInitDisabledWait(t *testing.T) {
+	resetForTest(t)
+	Init("")
+	if Enabled() {
+		t.Error("Enabled() = true with an empty PID file")
+	}
+	done := make(chan struct{})
+	go func() {
+		Wait()
+		close(done)
+	}()
+	waitClosed(t, done, "Wait")
+}
+
+func TestInitErrAlreadyInitialized(t *testing.T) {
+	resetForTest(t)
+	if err := InitErr(""); err != nil {
+		t.Fatalf("InitErr() = %v", err)
+	}
+	if err := InitErr(""); err != ErrAlreadyInitialized {
+		t.Errorf("second InitErr() = %v, want ErrAlreadyInitialized", err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("second Init did not panic")
+		}
+	}()
+	Init("")
+}
+
+func TestCallbacksRegistrationOrder(t *testing.T) {
+	for _, beforeInit := range []bool{true, false} {
+		t.Run(fmt.Sprintf("beforeInit=%v", beforeInit), func(t *testing.T) {
+			resetForTest(t)
+			var requested, shutdown bool
+			register := func() {
+				OnShutdownRequest(func() { requested = true })
+				OnShutdown(func() { shutdown = true })
+			}
+			if beforeInit {
+				register()
+			}
+			d := initTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+			if !beforeInit {
+				register()
+			}
+			d.requestShutdown(t)
+			d.terminate(t)
+			if !requested {
+				t.Error("OnShutdownRequest callback not called")
+			}
+			if !shutdown {
+				t.Error("OnShutdown callback not called")
+			}
+		})
+	}
+}
+
+func TestLateCallbackRegistration(t *testing.T) {
+	d := newTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+	logs := recordLogs(t)
+	OnShutdown(func() {})
+	d.requestShutdown(t)
+	OnShutdownRequest(func() { t.Error("late OnShutdownRequest callback called") })
+	if !logs.contains("OnShutdownRequest called after shutdown was requested") {
+		t.Error("late OnShutdownRequest registration not logged")
+	}
+	d.terminate(t)
+	OnShutdown(func() { t.Error("late OnShutdown callback called") })
+	if !logs.contains("OnShutdown called after graceful shutdown started") {
+		t.Error("late OnShutdown registration not logged")
+	}
+}
+
+func TestDone(t *testing.T) {
+	d := newTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+	OnShutdown(func() {})
+	d.requestShutdown(t)
+	select {
+	case <-Done():
+		t.Fatal("Done closed before the graceful shutdown")
+	default:
+	}
+	d.term <- syscall.SIGTERM
+	select {
+	case <-Done():
+	case <-time.After(testTimeout):
+		t.Fatal("Done not closed after the graceful shutdown")
+	}
+}
+
+func TestStartedStalePIDFile(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	newTestDaemon(t, pidFile)
+	logs := recordLogs(t)
+	sigs := recordSignals(t)
+	// The PID of a process which exited.
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(cmd.Process.Pid)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	Started()
+	if s := sigs.signals(); len(s) != 0 {
+		t.Errorf("signals sent: %v", s)
+	}
+	if !logs.contains("Ignoring stale PID file") {
+		t.Error("stale PID file not logged")
+	}
+	b, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), strconv.Itoa(os.Getpid()); got != want {
+		t.Errorf("PID file = %q, want %q", got, want)
+	}
+}
+
+func TestStartedJunkPIDFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		log     string
+	}{
+		{"large", strings.Repeat("junk\n", 1<<20/5), "file larger than"},
+		{"garbage", "junk", "invalid PID file content"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pidFile := filepath.Join(t.TempDir(), "app.pid")
+			newTestDaemon(t, pidFile)
+			logs := recordLogs(t)
+			sigs := recordSignals(t)
+			if err := os.WriteFile(pidFile, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			Started()
+			if s := sigs.signals(); len(s) != 0 {
+				t.Errorf("signals sent: %v", s)
+			}
+			if !logs.contains(tt.log) {
+				t.Errorf("%q not logged", tt.log)
+			}
+			b, err := os.ReadFile(pidFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := string(b), strconv.Itoa(os.Getpid()); got != want {
+				t.Errorf("PID file = %.20q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestStartedOwnPID(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	newTestDaemon(t, pidFile)
+	logs := recordLogs(t)
+	sigs := recordSignals(t)
+	// A PID file left by a previous container, the PID being reused.
+	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		t.Fatal(err)
+	}
+	Started()
+	if s := sigs.signals(); len(s) != 0 {
+		t.Errorf("signals sent: %v", s)
+	}
+	if !logs.contains("is the current process") {
+		t.Error("own PID not logged")
+	}
+}
+
+func TestOnStarted(t *testing.T) {
+	newTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+	calls := 0
+	OnStarted(func() { calls++ })
+	Started()
+	if calls != 1 {
+		t.Fatalf("OnStarted callback called %d times, want 1", calls)
+	}
+	// Only the first call to Started has an effect.
+	Started()
+	if calls != 1 {
+		t.Errorf("OnStarted callback called %d times after a second Started, want 1", calls)
+	}
+}
+
+func TestOnStartedPanic(t *testing.T) {
+	newTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+	logs := recordLogs(t)
+	called := false
+	OnStarted(func() { panic("started") })
+	OnStarted(func() { called = true })
+	Started()
+	if !called {
+		t.Error("OnStarted callback after the panicking one not called")
+	}
+	if !logs.contains("OnStarted callback panicked: started") {
+		t.Error("panic not logged")
+	}
+}
+
+func TestCallbackStages(t *testing.T) {
+	d := newTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+	var requestState, shutdownState State
+	OnShutdownRequest(func() { requestState = CurrentState() })
+	OnShutdown(func() { shutdownState = CurrentState() })
+	Started()
+	d.requestShutdown(t)
+	if requestState != StateRequested {
+		t.Errorf("OnShutdownRequest called in state %v, want %v", requestState, StateRequested)
+	}
+	if shutdownState != StateRunning {
+		t.Fatal("OnShutdown called before TERM")
+	}
+	d.terminate(t)
+	if shutdownState != StateShutdown {
+		t.Errorf("OnShutdown called in state %v, want %v", shutdownState, StateShutdown)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	tests := []struct {
+		name    string
+		pidFile string
+		setup   func(t *testing.T)
+	}{
+		{"empty PID file", "", func(t *testing.T) {}},
+		{"environment", pidFile, func(t *testing.T) { t.Setenv("SEAMLESS_DISABLE", "1") }},
+		{"Disable", pidFile, func(t *testing.T) { Disable() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetForTest(t)
+			recordLogs(t)
+			tt.setup(t)
+			Init(tt.pidFile)
+			if Enabled() {
+				t.Error("Enabled() = true")
+			}
+			if IsLauncher() {
+				t.Error("IsLauncher() = true")
+			}
+			if got := defaultController.pidFilePath; got != tt.pidFile {
+				t.Errorf("PID file path = %q, want %q", got, tt.pidFile)
+			}
+			if got := PIDFilePath(); got != "" {
+				t.Errorf("PIDFilePath() = %q, want an empty string", got)
+			}
+			waitClosed(t, Done(), "Wait")
+		})
+	}
+}
+
+func TestPIDFilePath(t *testing.T) {
+	resetForTest(t)
+	if got := PIDFilePath(); got != "" {
+		t.Errorf("PIDFilePath() = %q before Init, want an empty string", got)
+	}
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	initTestDaemon(t, pidFile)
+	if got := PIDFilePath(); got != pidFile {
+		t.Errorf("PIDFilePath() = %q, want %q", got, pidFile)
+	}
+}
+
+func TestCallbackPanic(t *testing.T) {
+	d := newTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+	logs := recordLogs(t)
+	OnShutdownRequest(func() { panic("request") })
+	OnShutdown(func() { panic("shutdown") })
+	d.requestShutdown(t)
+	d.terminate(t)
+	for _, msg := range []string{"OnShutdownRequest callback panicked: request", "OnShutdown callback panicked: shutdown"} {
+		if !logs.contains(msg) {
+			t.Errorf("%q not logged", msg)
+		}
+	}
+}
+
+func TestAbortRestart(t *testing.T) {
+	d := newTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+	recordLogs(t)
+	if err := AbortRestart(); err != ErrNoRestart {
+		t.Errorf("AbortRestart() without restart = %v, want ErrNoRestart", err)
+	}
+	abort := true
+	var abortErr error
+	OnShutdownRequest(func() {
+		if abort {
+			abortErr = AbortRestart()
+		}
+	})
+	shutdowns := 0
+	OnShutdown(func() { shutdowns++ })
+
+	d.requestShutdown(t)
+	if abortErr != nil {
+		t.Fatalf("AbortRestart() = %v", abortErr)
+	}
+	if s := CurrentState(); s != StateRunning {
+		t.Errorf("state after abort = %v, want %v", s, StateRunning)
+	}
+
+	// The daemon serves another restart request.
+	abort = false
+	d.requestShutdown(t)
+	d.terminate(t)
+	if shutdowns != 1 {
+		t.Errorf("OnShutdown called %d times, want 1", shutdowns)
+	}
+}
+
+func TestInitUnwritableDir(t *testing.T) {
+	tests := []struct {
+		name string
+		dir  func(t *testing.T) string
+	}{
+		{"missing", func(t *testing.T) string {
+			return filepath.Join(t.TempDir(), "missing")
+		}},
+		{"read-only", func(t *testing.T) string {
+			if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+				t.Skip("directory permissions not enforced")
+			}
+			dir := t.TempDir()
+			if err := os.Chmod(dir, 0500); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { os.Chmod(dir, 0700) })
+			return dir
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pidFile := filepath.Join(tt.dir(t), "app.pid")
+			t.Run("InitErr", func(t *testing.T) {
+				resetForTest(t)
+				recordLogs(t)
+				if err := InitErr(pidFile); err == nil {
+					t.Error("InitErr() succeeded")
+				}
+				if Enabled() {
+					t.Error("seamless enabled")
+				}
+			})
+			t.Run("Init", func(t *testing.T) {
+				resetForTest(t)
+				logs := recordLogs(t)
+				Init(pidFile)
+				if Enabled() {
+					t.Error("seamless enabled")
+				}
+				if !logs.contains("is not writable") {
+					t.Error("error not logged")
+				}
+				waitClosed(t, Done(), "Wait")
+			})
+		})
+	}
+}
+
+func TestOnPIDFileWritten(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	newTestDaemon(t, pidFile)
+	var paths []string
+	OnPIDFileWritten(func(path string) {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("PID file not written: %v", err)
+		}
+		paths = append(paths, path)
+	})
+	Started()
+	if want := []string{pidFile}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("OnPIDFileWritten called with %v, want %v", paths, want)
+	}
+}
+
+func TestOnPIDFileWrittenFailure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "run")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	newTestDaemon(t, filepath.Join(dir, "app.pid"))
+	logs := recordLogs(t)
+	OnPIDFileWritten(func(path string) {
+		t.Error("OnPIDFileWritten called while the PID file could not be written")
+	})
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	Started()
+	if !logs.contains("Could not create PID file") {
+		t.Error("PID file write failure not logged")
+	}
+}
+
+func TestSelfShutdownTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		want    ShutdownReason
+	}{
+		// The old daemon keeps serving until the new one sends TERM.
+		{"disabled", 0, ReasonSignal},
+		{"enabled", 50 * time.Millisecond, ReasonTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetForTest(t)
+			SetSelfShutdownTimeout(tt.timeout)
+			d := initTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+			recordLogs(t)
+			reasons := make(chan ShutdownReason, 1)
+			OnShutdownReason(func(reason ShutdownReason) { reasons <- reason })
+			d.requestShutdown(t)
+			select {
+			case <-Done():
+				if tt.timeout == 0 {
+					t.Fatal("shutdown engaged without TERM signal")
+				}
+			case <-time.After(200 * time.Millisecond):
+				if tt.timeout > 0 {
+					t.Fatal("shutdown not engaged after the self shutdown timeout")
+				}
+				d.terminate(t)
+			}
+			if reason := <-reasons; reason != tt.want {
+				t.Errorf("shutdown reason = %v, want %v", reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestShutdownRequestTimeout(t *testing.T) {
+	resetForTest(t)
+	const timeout = 50 * time.Millisecond
+	SetShutdownRequestTimeout(timeout)
+	d := initTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+	logs := recordLogs(t)
+	release := make(chan struct{})
+	defer close(release)
+	OnShutdownRequest(func() {
+		// Blocked on closing a slow resource.
+		<-release
+	})
+	start := time.Now()
+	d.requestShutdown(t)
+	if elapsed := time.Since(start); elapsed < timeout {
+		t.Errorf("launcher notified %s after the shutdown request, before the timeout", elapsed)
+	}
+	if !logs.contains("did not return within") {
+		t.Error("blocked OnShutdownRequest callback not logged")
+	}
+	d.terminate(t)
+}
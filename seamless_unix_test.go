@@ -0,0 +1,226 @@
+//go:build !windows
+// +build !windows
+
+package seamless
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startOldDaemon starts a process recognized as a seamless daemon (see
+// isSeamlessProcess) and returns its PID. The process is killed once the test
+// completes.
+func startOldDaemon(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command("sleep", "60")
+	cmd.Env = append(os.Environ(), "SEAMLESS=1")
+	if err := cmd.Start(); err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	deadline := time.Now().Add(testTimeout)
+	for !isSeamlessProcess(pidFileInfo{PID: cmd.Process.Pid}) {
+		if time.Now().After(deadline) {
+			t.Fatal("process not recognized as a seamless daemon")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return cmd.Process.Pid
+}
+
+func TestStartedConcurrent(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	newTestDaemon(t, pidFile)
+	recordLogs(t)
+	sigs := recordSignals(t)
+	old := startOldDaemon(t)
+	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(old)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Started()
+		}()
+	}
+	wg.Wait()
+	want := []sentSignal{{pid: old, sig: syscall.SIGTERM}}
+	if got := sigs.signals(); !reflect.DeepEqual(got, want) {
+		t.Errorf("signals sent = %v, want %v", got, want)
+	}
+}
+
+func TestStartedSignalRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		wantCalls    int
+		wantFailures int
+	}{
+		{"transient", 2, 3, 0},
+		{"persistent", 5, signalAttempts, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pidFile := filepath.Join(t.TempDir(), "app.pid")
+			newTestDaemon(t, pidFile)
+			logs := recordLogs(t)
+			if err := os.WriteFile(pidFile, []byte(strconv.Itoa(startOldDaemon(t))), 0644); err != nil {
+				t.Fatal(err)
+			}
+			calls := 0
+			orig := signalProcess
+			defer func() { signalProcess = orig }()
+			signalProcess = func(p *os.Process, sig os.Signal) error {
+				calls++
+				if calls <= tt.failures {
+					return syscall.EAGAIN
+				}
+				return nil
+			}
+			Started()
+			if calls != tt.wantCalls {
+				t.Errorf("signal attempts = %d, want %d", calls, tt.wantCalls)
+			}
+			if n := Stats().SignalFailures; n != tt.wantFailures {
+				t.Errorf("signal failures = %d, want %d", n, tt.wantFailures)
+			}
+			if failed := logs.contains("both processes keep serving"); failed != (tt.wantFailures > 0) {
+				t.Errorf("failure logged: %v", failed)
+			}
+		})
+	}
+}
+
+func TestShutdownRequestRightAfterInit(t *testing.T) {
+	resetForTest(t)
+	recordLogs(t)
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	setLauncherEnv(t, pidFile)
+	notified := make(chan struct{})
+	notifyParent = func() { close(notified) }
+	if err := InitErr(pidFile); err != nil {
+		t.Fatal(err)
+	}
+	// Sent before stage1 had a chance to run, the signal would kill the
+	// process if the handler was not registered yet.
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	waitClosed(t, notified, "launcher notification")
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	waitClosed(t, Done(), "Wait")
+}
+
+func TestShutdownRequestOrphaned(t *testing.T) {
+	resetForTest(t)
+	logs := recordLogs(t)
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	setLauncherEnv(t, pidFile)
+	ready := make(chan struct{})
+	OnStateChange(func(old, new State) {
+		if new == StateReady {
+			close(ready)
+		}
+	})
+	// The launcher dies during the shutdown request: the daemon is
+	// reparented.
+	OnShutdownRequest(func() { launcherPID = -1 })
+	if err := InitErr(pidFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	waitClosed(t, ready, "stage3")
+	if !logs.contains("is gone, continuing restart") {
+		t.Error("launcher death not logged")
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	waitClosed(t, Done(), "Wait")
+}
+
+func TestTermSignalQuit(t *testing.T) {
+	resetForTest(t)
+	recordLogs(t)
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	setLauncherEnv(t, pidFile)
+	SetTermSignal(syscall.SIGQUIT)
+	notified := make(chan struct{})
+	notifyParent = func() { close(notified) }
+	if err := InitErr(pidFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	waitClosed(t, notified, "launcher notification")
+	// This process plays both generations: the TERM signal Started sends to
+	// the old daemon is delivered to this process instead, where it must
+	// engage the graceful shutdown rather than dump the goroutines and exit.
+	old := startOldDaemon(t)
+	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(old)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var got sentSignal
+	orig := signalProcess
+	defer func() { signalProcess = orig }()
+	signalProcess = func(p *os.Process, sig os.Signal) error {
+		got = sentSignal{pid: p.Pid, sig: sig}
+		return syscall.Kill(os.Getpid(), sig.(syscall.Signal))
+	}
+	Started()
+	waitClosed(t, Done(), "Wait")
+	if want := (sentSignal{pid: old, sig: syscall.SIGQUIT}); got != want {
+		t.Errorf("signal sent = %v, want %v", got, want)
+	}
+}
+
+func TestReset(t *testing.T) {
+	resetForTest(t)
+	recordLogs(t)
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	for i := 0; i < 2; i++ {
+		setLauncherEnv(t, pidFile)
+		notified := make(chan struct{})
+		notifyParent = func() { close(notified) }
+		shutdowns := 0
+		OnShutdown(func() { shutdowns++ })
+		if err := InitErr(pidFile); err != nil {
+			t.Fatalf("cycle %d: InitErr() = %v", i, err)
+		}
+		if err := syscall.Kill(os.Getpid(), syscall.SIGUSR2); err != nil {
+			t.Fatal(err)
+		}
+		waitClosed(t, notified, "launcher notification")
+		if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+			t.Fatal(err)
+		}
+		waitClosed(t, Done(), "Wait")
+		// The callbacks of the previous cycle are forgotten.
+		if shutdowns != 1 {
+			t.Errorf("cycle %d: OnShutdown called %d times, want 1", i, shutdowns)
+		}
+		Reset()
+		if Enabled() {
+			t.Fatalf("cycle %d: Enabled() = true after Reset", i)
+		}
+	}
+}
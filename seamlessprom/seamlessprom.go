@@ -0,0 +1,90 @@
+// Package seamlessprom exposes the seamless restart metrics (see
+// seamless.Stats) and state as Prometheus metrics.
+//
+//	prometheus.MustRegister(seamlessprom.NewCollector())
+//
+// The metrics are read from seamless on each scrape, no update is needed.
+package seamlessprom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/seamless"
+)
+
+var (
+	restartsDesc = prometheus.NewDesc("seamless_restarts_total",
+		"Number of seamless restarts initiated (shutdown requests received).", nil, nil)
+	handoffDurationDesc = prometheus.NewDesc("seamless_handoff_duration_seconds",
+		"Duration between the last shutdown request and the signal sent back to the launcher.", nil, nil)
+	shutdownDurationDesc = prometheus.NewDesc("seamless_shutdown_duration_seconds",
+		"Duration of the last graceful shutdown.", nil, nil)
+	shutdownTimedOutDesc = prometheus.NewDesc("seamless_shutdown_timed_out",
+		"1 if the last graceful shutdown was triggered by the self shutdown timeout.", nil, nil)
+	degradedShutdownsDesc = prometheus.NewDesc("seamless_degraded_shutdowns_total",
+		"Number of graceful shutdowns which did not complete cleanly.", nil, nil)
+	signalFailuresDesc = prometheus.NewDesc("seamless_signal_failures_total",
+		"Number of signals driving the restart which could not be sent.", nil, nil)
+	stateDesc = prometheus.NewDesc("seamless_state",
+		"Current state of the seamless restart process, 1 for the current state.", []string{"state"}, nil)
+)
+
+// states lists all the states reported by the seamless_state metric.
+var states = []seamless.State{
+	seamless.StateRunning,
+	seamless.StateRequested,
+	seamless.StateReady,
+	seamless.StateShutdown,
+	seamless.StateDone,
+}
+
+// Collector is a prometheus.Collector reporting the metrics of a
+// seamless.Controller.
+type Collector struct {
+	c *seamless.Controller
+}
+
+// NewCollector returns a Collector reporting the metrics of the default
+// controller, i.e. the ones used by the seamless package level functions.
+func NewCollector() *Collector {
+	return NewControllerCollector(seamless.DefaultController())
+}
+
+// NewControllerCollector returns a Collector reporting the metrics of c.
+func NewControllerCollector(c *seamless.Controller) *Collector {
+	return &Collector{c: c}
+}
+
+// Describe implements prometheus.Collector.
+func (col *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- restartsDesc
+	ch <- handoffDurationDesc
+	ch <- shutdownDurationDesc
+	ch <- shutdownTimedOutDesc
+	ch <- degradedShutdownsDesc
+	ch <- signalFailuresDesc
+	ch <- stateDesc
+}
+
+// Collect implements prometheus.Collector.
+func (col *Collector) Collect(ch chan<- prometheus.Metric) {
+	m := col.c.Stats()
+	ch <- prometheus.MustNewConstMetric(restartsDesc, prometheus.CounterValue, float64(m.Restarts))
+	ch <- prometheus.MustNewConstMetric(handoffDurationDesc, prometheus.GaugeValue, m.HandoffDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(shutdownDurationDesc, prometheus.GaugeValue, m.ShutdownDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(shutdownTimedOutDesc, prometheus.GaugeValue, boolValue(m.ShutdownTimedOut))
+	// A process shuts down at most once, the counter is thus 0 or 1 for a
+	// given process, and sums up across generations.
+	ch <- prometheus.MustNewConstMetric(degradedShutdownsDesc, prometheus.CounterValue, boolValue(m.ShutdownDegraded))
+	ch <- prometheus.MustNewConstMetric(signalFailuresDesc, prometheus.CounterValue, float64(m.SignalFailures))
+	current := col.c.CurrentState()
+	for _, s := range states {
+		ch <- prometheus.MustNewConstMetric(stateDesc, prometheus.GaugeValue, boolValue(s == current), s.String())
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,43 @@
+package seamlessprom
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/seamless"
+)
+
+func TestCollector(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(NewControllerCollector(seamless.NewController())); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, mf := range mfs {
+		names = append(names, mf.GetName())
+		if mf.GetName() == "seamless_state" {
+			if n := len(mf.GetMetric()); n != len(states) {
+				t.Errorf("seamless_state has %d series, want %d", n, len(states))
+			}
+		}
+	}
+	sort.Strings(names)
+	want := []string{
+		"seamless_degraded_shutdowns_total",
+		"seamless_handoff_duration_seconds",
+		"seamless_restarts_total",
+		"seamless_shutdown_duration_seconds",
+		"seamless_shutdown_timed_out",
+		"seamless_signal_failures_total",
+		"seamless_state",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("metric names = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,61 @@
+// Package seamlesstest provides a harness to drive the seamless restart flow
+// in-process, without forking a launcher, so the callbacks registered with the
+// seamless package can be unit tested.
+//
+// As seamless relies on global state, harnesses must not be used in parallel.
+package seamlesstest
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/rs/seamless"
+	"github.com/rs/seamless/internal/harness"
+)
+
+// Harness drives the seamless restart stages of the current process as if it
+// was a daemon started by the launcher.
+type Harness struct {
+	shutdownRequest chan os.Signal
+	term            chan os.Signal
+	parent          chan struct{}
+}
+
+// NewHarness resets seamless and initializes it with pidFile as the PID file.
+// Callbacks must be registered after NewHarness is called.
+func NewHarness(pidFile string) *Harness {
+	h := &Harness{
+		shutdownRequest: make(chan os.Signal, 1),
+		term:            make(chan os.Signal, 1),
+		parent:          make(chan struct{}, 1),
+	}
+	harness.Reset()
+	if err := harness.Init(pidFile, h.shutdownRequest, h.term, func() {
+		h.parent <- struct{}{}
+	}); err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// RequestShutdown simulates the shutdown request sent by the launcher on
+// restart. It blocks until the OnShutdownRequest callbacks have returned and
+// the launcher has been notified, or the restart aborted (see
+// seamless.AbortRestart).
+func (h *Harness) RequestShutdown() {
+	h.shutdownRequest <- harness.ShutdownRequestSignal
+	<-h.parent
+}
+
+// Terminate simulates the TERM signal sent by the new daemon once started. It
+// blocks until the OnShutdown callbacks have returned. RequestShutdown must
+// have been called first.
+func (h *Harness) Terminate() {
+	h.term <- syscall.SIGTERM
+	seamless.Wait()
+}
+
+// Close resets seamless to its uninitialized state.
+func (h *Harness) Close() {
+	harness.Reset()
+}
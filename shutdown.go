@@ -0,0 +1,171 @@
+package seamless
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// shutdownFunc is a graceful shutdown callback with the phase it belongs to.
+type shutdownFunc struct {
+	phase int
+	f     func(ctx context.Context, reason ShutdownReason)
+}
+
+// shutdownTimeout is the overall deadline given to the shutdown phases.
+var shutdownTimeout time.Duration
+
+// SetShutdownTimeout sets the overall duration given to the graceful shutdown.
+// The context passed to the OnShutdownCtx and OnShutdownPhase callbacks
+// expires once this duration elapsed since the graceful shutdown started, so
+// each phase gets the remaining time. Seamless does not interrupt callbacks
+// exceeding the deadline, it is up to them to honor their context. A zero
+// timeout, the default, means no deadline.
+func SetShutdownTimeout(d time.Duration) {
+	if defaultController.inited {
+		panic("seamless.SetShutdownTimeout must be called before seamless.Init")
+	}
+	shutdownTimeout = d
+}
+
+// OnShutdownCtx is like OnShutdown but f receives a context cancelled once the
+// timeout set with SetShutdownTimeout elapsed, so it can be passed straight to
+// http.Server.Shutdown for instance. Without shutdown timeout, the context is
+// never cancelled while f runs. The context is also cancelled if a second TERM
+// signal is received during the graceful shutdown, so an impatient operator
+// (or supervisor) can hard-stop the drain. OnShutdownCtx callbacks are part of
+// the shutdown phase 0, see OnShutdownPhase.
+func OnShutdownCtx(f func(ctx context.Context)) {
+	defaultController.OnShutdownCtx(f)
+}
+
+// OnShutdownCtx is like the package level OnShutdownCtx function, operating on
+// c.
+func (c *Controller) OnShutdownCtx(f func(ctx context.Context)) {
+	c.OnShutdownPhase(0, f)
+}
+
+// OnShutdownPhase registers f to be called during the graceful shutdown as part
+// of the given phase. Phases are executed in ascending order, and callbacks of
+// the same phase in registration order, so a shutdown sequence can be declared
+// as a pipeline: stop accepting new work, drain workers, flush buffers, close
+// databases, etc. Callbacks registered with OnShutdown are part of phase 0.
+//
+// The ctx passed to f carries the deadline set with SetShutdownTimeout.
+//
+// Like OnShutdown, OnShutdownPhase may be called before or after Init. If the
+// graceful shutdown has already been engaged, f is never called and a warning
+// is logged.
+func OnShutdownPhase(phase int, f func(ctx context.Context)) {
+	defaultController.OnShutdownPhase(phase, f)
+}
+
+// OnShutdownPhase is like the package level OnShutdownPhase function,
+// operating on c.
+func (c *Controller) OnShutdownPhase(phase int, f func(ctx context.Context)) {
+	c.addShutdownFunc(phase, func(ctx context.Context, _ ShutdownReason) { f(ctx) })
+}
+
+func (c *Controller) addShutdownFunc(phase int, f func(ctx context.Context, reason ShutdownReason)) {
+	c.hooksMu.Lock()
+	defer c.hooksMu.Unlock()
+	if c.CurrentState() >= StateShutdown {
+		LogMessage("OnShutdown called after graceful shutdown started, callback ignored")
+		return
+	}
+	c.shutdownFuncs = append(c.shutdownFuncs, shutdownFunc{phase: phase, f: f})
+}
+
+// sortedShutdownFuncs returns the shutdown callbacks in execution order. It
+// must be called with c.hooksMu held.
+func (c *Controller) sortedShutdownFuncs() []shutdownFunc {
+	funcs := make([]shutdownFunc, len(c.shutdownFuncs))
+	copy(funcs, c.shutdownFuncs)
+	sort.SliceStable(funcs, func(i, j int) bool {
+		return funcs[i].phase < funcs[j].phase
+	})
+	return funcs
+}
+
+// shutdownContext returns the context passed to the shutdown callbacks for a
+// graceful shutdown started at start.
+func shutdownContext(start time.Time) (context.Context, context.CancelFunc) {
+	if shutdownTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithDeadline(context.Background(), start.Add(shutdownTimeout))
+}
+
+// OnDrainStart registers f to be called when the graceful shutdown begins,
+// before any OnShutdown callback (of any phase, see OnShutdownPhase). It is
+// the place to deregister the daemon from service discovery (Consul, etcd...)
+// so no new requests are routed to it before it drains. An error returned by f
+// is logged and does not prevent the graceful shutdown.
+func OnDrainStart(f func() error) {
+	defaultController.OnDrainStart(f)
+}
+
+// OnDrainStart is like the package level OnDrainStart function, operating on
+// c.
+func (c *Controller) OnDrainStart(f func() error) {
+	c.hooksMu.Lock()
+	defer c.hooksMu.Unlock()
+	c.drainStartFuncs = append(c.drainStartFuncs, f)
+}
+
+// MarkShutdownDegraded reports from an OnShutdown callback that the graceful
+// shutdown could not complete cleanly, for instance because connections had
+// to be force closed once a drain timeout elapsed. The degradation is
+// reflected in Stats and triggers the OnDegradedShutdown callbacks once the
+// shutdown callbacks returned.
+func MarkShutdownDegraded() {
+	defaultController.MarkShutdownDegraded()
+}
+
+// MarkShutdownDegraded is like the package level MarkShutdownDegraded
+// function, operating on c.
+func (c *Controller) MarkShutdownDegraded() {
+	atomic.StoreInt32(&c.degraded, 1)
+}
+
+// OnDegradedShutdown registers f to be called once the OnShutdown callbacks
+// returned if the graceful shutdown was degraded: its context expired or was
+// cancelled before the callbacks returned (see OnShutdownCtx), or a callback
+// called MarkShutdownDegraded. Seamless never exits the daemon itself, so f
+// (or the caller of Wait, checking Stats().ShutdownDegraded) is where a
+// non-zero exit status can be decided for alerting.
+func OnDegradedShutdown(f func()) {
+	defaultController.OnDegradedShutdown(f)
+}
+
+// OnDegradedShutdown is like the package level OnDegradedShutdown function,
+// operating on c.
+func (c *Controller) OnDegradedShutdown(f func()) {
+	c.hooksMu.Lock()
+	defer c.hooksMu.Unlock()
+	c.degradedFuncs = append(c.degradedFuncs, f)
+}
+
+// TrackWorker registers a background worker, like a ticker or a queue
+// consumer, the graceful shutdown must wait for. The returned function must be
+// called once the worker is done; calling it more than once has no effect.
+//
+// Once the OnShutdown callbacks returned, which is where workers are typically
+// asked to stop, the graceful shutdown waits for the tracked workers to be
+// done, until the shutdown deadline (see SetShutdownTimeout) if any, before
+// Wait unblocks. A shutdown cut short with workers still running is degraded
+// (see OnDegradedShutdown).
+func TrackWorker() (done func()) {
+	return defaultController.TrackWorker()
+}
+
+// TrackWorker is like the package level TrackWorker function, operating on c.
+func (c *Controller) TrackWorker() (done func()) {
+	c.workers.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(c.workers.Done)
+	}
+}
@@ -0,0 +1,234 @@
+package seamless
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShutdownPhases(t *testing.T) {
+	resetForTest(t)
+	SetShutdownTimeout(time.Minute)
+	d := initTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+	var order []string
+	var deadlines []time.Time
+	phase := func(name string) func(ctx context.Context) {
+		return func(ctx context.Context) {
+			order = append(order, name)
+			deadline, ok := ctx.Deadline()
+			if !ok {
+				t.Errorf("%s: no deadline", name)
+			}
+			deadlines = append(deadlines, deadline)
+		}
+	}
+	OnShutdownPhase(2, phase("flush"))
+	OnShutdownPhase(0, phase("stop accepting"))
+	OnShutdownCtx(phase("stop workers"))
+	OnShutdownPhase(1, phase("drain"))
+	d.requestShutdown(t)
+	start := time.Now()
+	d.terminate(t)
+	want := []string{"stop accepting", "stop workers", "drain", "flush"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+	for i, deadline := range deadlines {
+		if !deadline.Equal(deadlines[0]) {
+			t.Errorf("%s: deadline %v, want the overall deadline %v", order[i], deadline, deadlines[0])
+		}
+	}
+	if len(deadlines) > 0 {
+		if remaining := deadlines[0].Sub(start); remaining < time.Minute || remaining > time.Minute+time.Second {
+			t.Errorf("deadline %s after the shutdown started, want %s", remaining, time.Minute)
+		}
+	}
+}
+
+func TestShutdownNoTimeout(t *testing.T) {
+	d := newTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+	OnShutdownCtx(func(ctx context.Context) {
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("deadline set without shutdown timeout")
+		}
+	})
+	d.requestShutdown(t)
+	d.terminate(t)
+}
+
+func TestShutdownSecondTerm(t *testing.T) {
+	d := newTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+	recordLogs(t)
+	draining := make(chan struct{})
+	OnShutdownCtx(func(ctx context.Context) {
+		close(draining)
+		// A drain only ending when the context is cancelled.
+		<-ctx.Done()
+	})
+	d.requestShutdown(t)
+	d.term <- syscall.SIGTERM
+	waitClosed(t, draining, "graceful shutdown")
+	d.term <- syscall.SIGTERM
+	waitClosed(t, Done(), "Wait")
+	if !Stats().ShutdownDegraded {
+		t.Error("cancelled shutdown not reported as degraded")
+	}
+}
+
+func TestShutdownDegradedTimeout(t *testing.T) {
+	resetForTest(t)
+	SetShutdownTimeout(50 * time.Millisecond)
+	d := initTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+	recordLogs(t)
+	OnShutdownCtx(func(ctx context.Context) {
+		// A drain force closing the connections left at the deadline.
+		<-ctx.Done()
+	})
+	degraded := 0
+	OnDegradedShutdown(func() { degraded++ })
+	d.requestShutdown(t)
+	d.terminate(t)
+	if degraded != 1 {
+		t.Errorf("OnDegradedShutdown called %d times, want 1", degraded)
+	}
+	if !Stats().ShutdownDegraded {
+		t.Error("Stats().ShutdownDegraded = false after a timed out shutdown")
+	}
+}
+
+func TestShutdownNotDegraded(t *testing.T) {
+	resetForTest(t)
+	SetShutdownTimeout(time.Minute)
+	d := initTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+	recordLogs(t)
+	OnShutdownCtx(func(ctx context.Context) {})
+	OnDegradedShutdown(func() { t.Error("OnDegradedShutdown called") })
+	d.requestShutdown(t)
+	d.terminate(t)
+	if Stats().ShutdownDegraded {
+		t.Error("Stats().ShutdownDegraded = true after a completed shutdown")
+	}
+}
+
+func TestTrackWorker(t *testing.T) {
+	d := newTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+	recordLogs(t)
+	done1, done2 := TrackWorker(), TrackWorker()
+	d.requestShutdown(t)
+	d.term <- syscall.SIGTERM
+	for _, done := range []func(){done1, done1, done2} {
+		select {
+		case <-Done():
+			t.Fatal("Wait unblocked with a worker still running")
+		case <-time.After(50 * time.Millisecond):
+		}
+		// Calling done twice must not account for the other worker.
+		done()
+	}
+	waitClosed(t, Done(), "Wait")
+	if Stats().ShutdownDegraded {
+		t.Error("shutdown degraded with all workers done")
+	}
+}
+
+func TestTrackWorkerDeadline(t *testing.T) {
+	resetForTest(t)
+	SetShutdownTimeout(50 * time.Millisecond)
+	d := initTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+	recordLogs(t)
+	TrackWorker()
+	d.requestShutdown(t)
+	d.terminate(t)
+	if !Stats().ShutdownDegraded {
+		t.Error("shutdown not degraded with a worker still running")
+	}
+}
+
+func TestOnDrainStart(t *testing.T) {
+	d := newTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+	logs := recordLogs(t)
+	var order []string
+	OnShutdownPhase(-1, func(ctx context.Context) { order = append(order, "early shutdown") })
+	OnShutdown(func() { order = append(order, "shutdown") })
+	OnDrainStart(func() error {
+		order = append(order, "deregister")
+		return errors.New("consul unreachable")
+	})
+	OnDrainStart(func() error {
+		order = append(order, "drain start")
+		return nil
+	})
+	d.requestShutdown(t)
+	d.terminate(t)
+	want := []string{"deregister", "drain start", "early shutdown", "shutdown"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+	if !logs.contains("OnDrainStart callback failed") {
+		t.Error("OnDrainStart error not logged")
+	}
+}
+
+// stepClock is a clock whose After channels fire when the test calls step.
+type stepClock struct {
+	timers chan chan time.Time
+}
+
+func (c *stepClock) Now() time.Time { return time.Now() }
+
+func (c *stepClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	c.timers <- ch
+	return ch
+}
+
+// next returns the next timer armed with After.
+func (c *stepClock) next(t *testing.T) chan time.Time {
+	t.Helper()
+	select {
+	case ch := <-c.timers:
+		return ch
+	case <-time.After(testTimeout):
+		t.Fatal("no timer armed")
+		return nil
+	}
+}
+
+// step fires the next timer armed with After.
+func (c *stepClock) step(t *testing.T) {
+	t.Helper()
+	c.next(t) <- time.Now()
+}
+
+func TestDrainProgress(t *testing.T) {
+	resetForTest(t)
+	logs := recordLogs(t)
+	calls := 0
+	SetDrainProgress(func() string {
+		calls++
+		return strconv.Itoa(calls) + " connections"
+	}, time.Second)
+	c := &stepClock{timers: make(chan chan time.Time)}
+	orig := clk
+	clk = c
+	defer func() { clk = orig }()
+	stop := reportDrainProgress()
+	c.step(t)
+	c.step(t)
+	// The next timer is armed once the second report is logged.
+	c.next(t)
+	stop()
+	for _, msg := range []string{"in progress: 1 connections", "in progress: 2 connections"} {
+		if !logs.contains(msg) {
+			t.Errorf("%q not logged", msg)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("progress called %d times, want 2", calls)
+	}
+}
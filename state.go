@@ -0,0 +1,80 @@
+package seamless
+
+// State represents the stage of the seamless restart process the current
+// process is in.
+type State int
+
+const (
+	// StateRunning is the initial state: the daemon is serving and no restart
+	// has been requested yet.
+	StateRunning State = iota
+	// StateRequested is entered when a restart is requested (TERM received by
+	// the launcher, USR2 received by the daemon).
+	StateRequested
+	// StateReady is entered once the daemon is ready to welcome a new version
+	// of itself and the launcher has been signaled.
+	StateReady
+	// StateShutdown is entered when the graceful shutdown is engaged.
+	StateShutdown
+	// StateDone is entered once the graceful shutdown is completed.
+	StateDone
+)
+
+func (s State) String() string {
+	switch s {
+	case StateRunning:
+		return "running"
+	case StateRequested:
+		return "requested"
+	case StateReady:
+		return "ready"
+	case StateShutdown:
+		return "shutdown"
+	case StateDone:
+		return "done"
+	}
+	return "unknown"
+}
+
+// CurrentState returns the current state of the seamless restart process.
+func CurrentState() State {
+	return defaultController.CurrentState()
+}
+
+// CurrentState is like the package level CurrentState function, operating on
+// c.
+func (c *Controller) CurrentState() State {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.state
+}
+
+// OnStateChange registers f to be called on each state transition. Callbacks
+// are called synchronously, in registration order, from the goroutine
+// performing the transition. Transitions happen in both the launcher and the
+// daemon process.
+func OnStateChange(f func(old, new State)) {
+	defaultController.OnStateChange(f)
+}
+
+// OnStateChange is like the package level OnStateChange function, operating on
+// c.
+func (c *Controller) OnStateChange(f func(old, new State)) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.onStateChangeFuncs = append(c.onStateChangeFuncs, f)
+}
+
+func (c *Controller) setState(s State) {
+	c.stateMu.Lock()
+	old := c.state
+	c.state = s
+	funcs := c.onStateChangeFuncs
+	c.stateMu.Unlock()
+	if old == s {
+		return
+	}
+	for _, f := range funcs {
+		f(old, s)
+	}
+}
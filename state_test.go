@@ -0,0 +1,34 @@
+package seamless
+
+import (
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestOnStateChange(t *testing.T) {
+	d := newTestDaemon(t, filepath.Join(t.TempDir(), "app.pid"))
+	var mu sync.Mutex
+	var got []State
+	OnStateChange(func(old, new State) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(got) == 0 {
+			got = append(got, old)
+		}
+		got = append(got, new)
+	})
+	OnShutdown(func() {})
+	d.requestShutdown(t)
+	d.terminate(t)
+	mu.Lock()
+	defer mu.Unlock()
+	want := []State{StateRunning, StateRequested, StateReady, StateShutdown, StateDone}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("states = %v, want %v", got, want)
+	}
+	if s := CurrentState(); s != StateDone {
+		t.Errorf("CurrentState() = %v, want %v", s, StateDone)
+	}
+}
@@ -0,0 +1,235 @@
+//go:build !windows
+// +build !windows
+
+package seamless
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// InitSupervised initializes seamless like Init, except that the launcher
+// stays alive across restarts and supervises the daemon generations itself,
+// making seamless self-contained when no external supervisor is used.
+//
+// On a restart signal, the launcher requests the current daemon to prepare for
+// the restart (see OnShutdownRequest) and, once it is ready, starts a new
+// daemon. The new daemon takes over with Started, which engages the graceful
+// shutdown of the old one as in the launcher model, and the launcher keeps
+// supervising the new daemon. If the old daemon does not acknowledge the
+// restart within the handoff timeout (see SetHandoffTimeout), the new daemon
+// is started anyway, the old one keeps serving until the new one calls
+// Started.
+//
+// In supervised mode, the restart is triggered by the HUP signal unless
+// restart signals are set with SetRestartSignal. The HUP signal is thus not
+// forwarded to the daemon, see OnReload. The TERM and INT signals, as well as
+// the signal set with SetStopSignal, stop the service: the current daemon is
+// sent a TERM signal and engages its graceful shutdown with ReasonStop, and
+// the launcher exits once all the daemons exited, with a status matching the
+// current daemon's. Previous daemons not notified by a new one by then are
+// sent the TERM signal (see SetTermSignal) after the handoff timeout.
+func InitSupervised(pidFile string, opts ...Option) error {
+	if defaultController.inited {
+		return ErrAlreadyInitialized
+	}
+	applyOptions(opts)
+	supervised = true
+	if !restartSignalsSet {
+		restartSignals = []os.Signal{syscall.SIGHUP}
+	}
+	if stopSignal == nil {
+		stopSignal = syscall.SIGTERM
+	}
+	return InitErr(pidFile)
+}
+
+// supervise runs the launcher in supervised mode, see InitSupervised.
+func supervise() {
+	setProcTitle("launcher")
+	code := runSupervisor()
+	removeLauncherNonce(defaultController.pidFilePath)
+	fireLauncherEvent(LauncherExiting)
+	os.Exit(code)
+}
+
+// runSupervisor starts the child process and supervises its generations until
+// the service is stopped, and returns the exit code of the launcher.
+func runSupervisor() int {
+	ackR, ackW, acks, err := newAckPipe()
+	if err != nil {
+		LogError("Could not create the handoff pipe", err)
+		return 1
+	}
+	defer ackR.Close()
+	defer ackW.Close()
+	cmd, argv, attrs, err := childCommand(ackW)
+	if err != nil {
+		LogError("Could not determin executable path", err)
+		return 1
+	}
+	cur, err := startChild(cmd, argv, attrs)
+	if err != nil {
+		return 1
+	}
+
+	c := make(chan os.Signal, 10)
+	signal.Notify(c, append(forwardedSignals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGCHLD, syscall.SIGPIPE, parentTermSignal, sigShutdownRequest, stopSignal)...)
+	signal.Notify(c, restartSignals...)
+	defer signal.Stop(c)
+	// draining are the previous generations engaged in their graceful
+	// shutdown, or about to be.
+	draining := map[int]*os.Process{}
+	restarting := false
+	stopping := false
+	attempts := 0
+	curCode := 0
+	var handoffTimeoutC, lingerC <-chan time.Time
+	// handoff starts the new generation once the current one is ready.
+	handoff := func() error {
+		restarting = false
+		handoffTimeoutC = nil
+		p, err := startChild(cmd, argv, attrs)
+		if err != nil {
+			return err
+		}
+		draining[cur.Pid] = cur
+		cur = p
+		defaultController.setState(StateRunning)
+		return nil
+	}
+	for {
+		var sig os.Signal
+		select {
+		case sig = <-c:
+		case <-acks:
+			if restarting {
+				fireLauncherEvent(LauncherHandoffAcknowledged)
+				defaultController.setState(StateReady)
+				if err := handoff(); err != nil {
+					LogError("Could not start new process", err)
+				}
+			}
+			continue
+		case <-lingerC:
+			// The previous generations never notified by a new daemon
+			// would wait forever.
+			for pid, p := range draining {
+				LogMessage(fmt.Sprintf("Stopping old process %d", pid))
+				if err := p.Signal(termSignal); err != nil {
+					LogError(fmt.Sprintf("Could not send %s signal", termSignal), err)
+				}
+			}
+			continue
+		case <-handoffTimeoutC:
+			LogMessage("Child timeout, starting the new process anyway")
+			fireLauncherEvent(LauncherChildTimeout)
+			if err := handoff(); err != nil {
+				LogError("Could not start new process", err)
+			}
+			continue
+		}
+		switch {
+		case sig == stopSignal || sig == syscall.SIGTERM || sig == syscall.SIGINT:
+			if stopping {
+				continue
+			}
+			stopping = true
+			LogMessage("Stop requested")
+			// The daemon engages its graceful shutdown with ReasonStop on
+			// TERM, whatever the stop signal (see notifyShutdownRequest).
+			if err := cur.Signal(syscall.SIGTERM); err != nil {
+				LogError("Could not send TERM signal", err)
+			}
+		case isRestartSignal(sig):
+			if restarting || stopping {
+				continue
+			}
+			defaultController.setState(StateRequested)
+			if err := sendCriticalSignal(cur, sigShutdownRequest); err != nil {
+				LogError("Could not send USR2 signal", err)
+				defaultController.updateMetrics(func(m *Metrics) { m.SignalFailures++ })
+				defaultController.setState(StateRunning)
+				continue
+			}
+			fireLauncherEvent(LauncherRestartSignalled)
+			restarting = true
+			handoffTimeoutC = clk.After(handoffTimeout)
+		case sig == sigShutdownRequest:
+			if restarting {
+				restarting = false
+				handoffTimeoutC = nil
+				LogMessage("Restart aborted by child")
+				defaultController.setState(StateRunning)
+				continue
+			}
+			if cur == nil {
+				continue
+			}
+			if err := cur.Signal(sig); err != nil {
+				LogError(fmt.Sprintf("Error forwarding %s signal", sig), err)
+			}
+		case sig == parentTermSignal || sig == syscall.SIGCHLD:
+			changed := false
+			for pid := range draining {
+				if ws, ok := waitChild(pid); ok && (ws.Exited() || ws.Signaled()) {
+					LogMessage(fmt.Sprintf("Old process %d exited", pid))
+					delete(draining, pid)
+					changed = true
+				}
+			}
+			if cur == nil {
+				// Stopping, the current generation already exited.
+			} else if ws, ok := waitChild(cur.Pid); ok {
+				changed = true
+				if ws.Exited() || ws.Signaled() {
+					curCode = exitCode(ws)
+					if stopping {
+						cur = nil
+						lingerC = clk.After(handoffTimeout)
+					} else if attempts < childRestartAttempts {
+						backoff := childRestartBackoff << uint(attempts)
+						attempts++
+						LogError(fmt.Sprintf("Child died unexpectedly, relaunching in %s", backoff), waitStatusError(ws))
+						restarting = false
+						handoffTimeoutC = nil
+						<-clk.After(backoff)
+						if cur, err = startChild(cmd, argv, attrs); err != nil {
+							return 1
+						}
+						defaultController.setState(StateRunning)
+						continue
+					} else {
+						return curCode
+					}
+				}
+			}
+			if stopping {
+				if cur == nil && len(draining) == 0 {
+					return curCode
+				}
+				continue
+			}
+			// The handoff is acknowledged through the handoff pipe, see
+			// runLauncher.
+			if !changed && restarting && sig == parentTermSignal && sig != syscall.SIGCHLD {
+				fireLauncherEvent(LauncherHandoffAcknowledged)
+				defaultController.setState(StateReady)
+				if err := handoff(); err != nil {
+					LogError("Could not start new process", err)
+				}
+			}
+		case ignoredSignal(sig):
+		default:
+			if cur == nil {
+				continue
+			}
+			if err := cur.Signal(sig); err != nil {
+				LogError(fmt.Sprintf("Error forwarding %s signal", sig), err)
+			}
+		}
+	}
+}
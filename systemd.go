@@ -0,0 +1,45 @@
+package seamless
+
+import (
+	"net"
+	"os"
+)
+
+var systemdNotify bool
+
+// EnableSystemdNotify enables systemd notifications for services of
+// Type=notify. When enabled, seamless sends READY=1 from Started, RELOADING=1
+// when a shutdown is requested and STOPPING=1 when the graceful shutdown
+// starts. If the NOTIFY_SOCKET environment variable is not set, no
+// notification is sent.
+//
+// As notifications are sent by the daemon and not by the launcher (the main
+// process from systemd point of view), the service must be configured with
+// NotifyAccess=all.
+func EnableSystemdNotify() {
+	if defaultController.inited {
+		panic("seamless.EnableSystemdNotify must be called before seamless.Init")
+	}
+	systemdNotify = true
+}
+
+// sdNotify sends state to the systemd notification socket if systemd
+// notifications are enabled.
+func sdNotify(state string) {
+	if !systemdNotify {
+		return
+	}
+	sock := os.Getenv("NOTIFY_SOCKET")
+	if sock == "" {
+		return
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: sock, Net: "unixgram"})
+	if err != nil {
+		LogError("Could not connect to systemd notify socket", err)
+		return
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte(state)); err != nil {
+		LogError("Could not send systemd notification", err)
+	}
+}
@@ -0,0 +1,5 @@
+package seamless
+
+import "golang.org/x/sys/unix"
+
+const ioctlReadTermios = unix.TCGETS
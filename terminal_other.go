@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package seamless
+
+import "os"
+
+// isTerminal can't tell terminals apart on this platform and always reports
+// false.
+func isTerminal(f *os.File) bool {
+	return false
+}
@@ -0,0 +1,93 @@
+package seamless
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+)
+
+type unixSocket struct {
+	path string
+	fi   os.FileInfo
+}
+
+var (
+	unixSocketsMu sync.Mutex
+	unixSockets   []unixSocket
+)
+
+// ListenUnix announces on the unix socket at path using the ownership model
+// suited for seamless restarts: the socket file belongs to the latest
+// generation of the daemon.
+//
+// Any existing socket file at path is removed before binding, so the new
+// daemon takes the socket over while the old daemon keeps accepting on its
+// (now unlinked) socket until its graceful shutdown. Closing the listener
+// never unlinks the socket file, so the old daemon can't remove the socket of
+// the new one. Once the graceful shutdown completes, the socket file is
+// removed only if it is still the one created by this process, i.e. if no new
+// daemon took it over.
+//
+// The listener is watched across the restart, see WatchListener.
+func ListenUnix(path string) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Net: "unix", Name: path})
+	if err != nil {
+		return nil, err
+	}
+	l.SetUnlinkOnClose(false)
+	_ = ManageUnixSocket(path)
+	WatchListener(l)
+	return l, nil
+}
+
+// ManageUnixSocket hands the cleanup of the unix socket file at path, bound by
+// the caller, over to seamless, using the ownership model of ListenUnix: the
+// socket file is removed once the graceful shutdown completes only if it is
+// still the one bound by this process. This covers all restart orderings: the
+// old daemon never removes the socket of a new daemon which rebound the path,
+// even if its shutdown completes after the new daemon started, and the last
+// generation removes its own socket on exit.
+//
+// ManageUnixSocket must be called right after binding the socket, before any
+// new daemon could take the path over. The caller must disable the removal of
+// the socket file on close (see net.UnixListener.SetUnlinkOnClose) and is
+// responsible for removing any existing file at path before binding, like a
+// socket left by a crashed generation, as ListenUnix does.
+func ManageUnixSocket(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s is not a unix socket", path)
+	}
+	unixSocketsMu.Lock()
+	defer unixSocketsMu.Unlock()
+	for i, s := range unixSockets {
+		if s.path == path {
+			unixSockets[i].fi = fi
+			return nil
+		}
+	}
+	unixSockets = append(unixSockets, unixSocket{path: path, fi: fi})
+	return nil
+}
+
+// removeUnixSockets removes the socket files created by ListenUnix or handed
+// over with ManageUnixSocket that have not been taken over by a new daemon.
+func removeUnixSockets() {
+	unixSocketsMu.Lock()
+	defer unixSocketsMu.Unlock()
+	for _, s := range unixSockets {
+		if fi, err := os.Stat(s.path); err == nil && os.SameFile(fi, s.fi) {
+			if err := os.Remove(s.path); err != nil {
+				LogError("Could not remove unix socket", err)
+			}
+		}
+	}
+	unixSockets = nil
+}
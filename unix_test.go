@@ -0,0 +1,118 @@
+//go:build !windows
+// +build !windows
+
+package seamless
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenUnixTakeOver(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.sock")
+	d := newTestDaemon(t, filepath.Join(dir, "app.pid"))
+	// A socket file left by a crashed generation.
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := ListenUnix(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	OnShutdown(func() { l.Close() })
+	d.requestShutdown(t)
+
+	// The new generation, in another process, takes the socket over.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	nl, err := net.ListenUnix("unix", &net.UnixAddr{Net: "unix", Name: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nl.SetUnlinkOnClose(false)
+	defer nl.Close()
+
+	d.terminate(t)
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("socket of the new generation removed: %v", err)
+	}
+	conn.Close()
+}
+
+func TestListenUnixLastGeneration(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.sock")
+	d := newTestDaemon(t, filepath.Join(dir, "app.pid"))
+	l, err := ListenUnix(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	OnShutdown(func() {
+		l.Close()
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("socket removed on close: %v", err)
+		}
+	})
+	d.requestShutdown(t)
+	d.terminate(t)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket of the last generation not removed: %v", err)
+	}
+}
+
+func TestManageUnixSocketOldCrashed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.sock")
+	// The old generation crashed, leaving its socket file behind.
+	old, err := net.ListenUnix("unix", &net.UnixAddr{Net: "unix", Name: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.SetUnlinkOnClose(false)
+	old.Close()
+
+	d := newTestDaemon(t, filepath.Join(dir, "app.pid"))
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Net: "unix", Name: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.SetUnlinkOnClose(false)
+	if err := ManageUnixSocket(path); err != nil {
+		t.Fatal(err)
+	}
+	OnShutdown(func() { l.Close() })
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("stale socket not replaced: %v", err)
+	}
+	conn.Close()
+
+	// No new generation: this one is the last and removes its socket.
+	d.requestShutdown(t)
+	d.terminate(t)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket of the last generation not removed: %v", err)
+	}
+}
+
+func TestManageUnixSocketNotSocket(t *testing.T) {
+	resetForTest(t)
+	path := filepath.Join(t.TempDir(), "app.sock")
+	if err := ManageUnixSocket(path); err == nil {
+		t.Error("no error for a missing socket")
+	}
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ManageUnixSocket(path); err == nil {
+		t.Error("no error for a regular file")
+	}
+}
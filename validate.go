@@ -0,0 +1,45 @@
+//go:build !windows
+// +build !windows
+
+package seamless
+
+import (
+	"errors"
+	"strings"
+)
+
+// Validate checks that seamless is correctly set up to run with pidFile as
+// the PID file, without forking, signaling nor blocking: the PID file and
+// control socket directories must be writable, the executable must be
+// resolvable by the launcher and an OnShutdown callback must be registered.
+// It is intended to be called from a configuration check mode (like a
+// --check-config flag), after the callbacks have been registered, so
+// deployments can catch problems early. All detected problems are reported in
+// the returned error.
+func Validate(pidFile string) error {
+	var problems []string
+	if pidFile == "" {
+		problems = append(problems, "no PID file, seamless restart would be disabled")
+	} else if err := checkWritableDir(pidFile); err != nil {
+		problems = append(problems, strings.TrimPrefix(err.Error(), "seamless: "))
+	}
+	if controlPath != "" {
+		if err := checkWritableDir(controlPath); err != nil {
+			problems = append(problems, strings.TrimPrefix(err.Error(), "seamless: "))
+		}
+	}
+	if _, err := executable(); err != nil {
+		problems = append(problems, "cannot resolve executable: "+err.Error())
+	}
+	c := defaultController
+	c.hooksMu.Lock()
+	noShutdownFuncs := len(c.shutdownFuncs) == 0
+	c.hooksMu.Unlock()
+	if noShutdownFuncs {
+		problems = append(problems, "no OnShutdown callback registered")
+	}
+	if len(problems) > 0 {
+		return errors.New("seamless: invalid setup: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+//go:build !windows
+// +build !windows
+
+package seamless
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "app.pid")
+	missing := filepath.Join(dir, "missing", "app.pid")
+	tests := []struct {
+		name    string
+		pidFile string
+		setup   func(t *testing.T)
+		want    string
+	}{
+		{"valid", pidFile, func(t *testing.T) {}, ""},
+		{"no PID file", "", func(t *testing.T) {}, "no PID file"},
+		{"unwritable PID file directory", missing, func(t *testing.T) {}, "is not writable"},
+		{"unwritable control socket directory", pidFile, func(t *testing.T) {
+			UseControlSocket(missing)
+		}, "is not writable"},
+		{"missing callback", pidFile, func(t *testing.T) {
+			defaultController.shutdownFuncs = nil
+		}, "no OnShutdown callback registered"},
+		{"unresolvable executable", pidFile, func(t *testing.T) {
+			origExecutable, origArgs := osExecutable, os.Args
+			t.Cleanup(func() {
+				osExecutable, os.Args = origExecutable, origArgs
+			})
+			osExecutable = func() (string, error) {
+				return "", errors.New("executable deleted")
+			}
+			os.Args = []string{"seamless-test-no-such-command"}
+		}, "cannot resolve executable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetForTest(t)
+			recordLogs(t)
+			OnShutdown(func() {})
+			tt.setup(t)
+			err := Validate(tt.pidFile)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
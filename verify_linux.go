@@ -0,0 +1,136 @@
+package seamless
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// startTimeTolerance is the accepted difference between the start time of a
+// process and the one recorded for it, accounting for the second precision of
+// the PID file and of the boot time.
+const startTimeTolerance = 2 * time.Second
+
+// isSeamlessProcess reports whether the process described by info is a daemon
+// started by a seamless launcher, by looking for the SEAMLESS environment
+// marker in its initial environment. This prevents from signaling an
+// unrelated process that would have recycled the PID of a dead daemon.
+//
+// Processes not started by a launcher, like the first generation in re-exec
+// mode or in no-launcher mode, have no marker. As a last resort, a process
+// running an executable with the same name as the current process is
+// accepted if its start time is consistent with info: matching the start time
+// recorded in the PID file (see SetPIDFileMetadata), or else before the PID
+// file was written, as a process recycling the PID of a dead daemon started
+// after it. Only the name is compared, as the new version is commonly deployed
+// to another directory, like a versioned release directory. The name alone is
+// not enough: another instance of the same executable could have recycled the
+// PID.
+func isSeamlessProcess(info pidFileInfo) bool {
+	pid := info.PID
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+	if err != nil {
+		return false
+	}
+	for _, kv := range bytes.Split(b, []byte{0}) {
+		if bytes.HasPrefix(kv, []byte("SEAMLESS=")) {
+			return true
+		}
+	}
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return false
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return false
+	}
+	// The executable of the old process may have been replaced by a new
+	// version during the deploy.
+	if filepath.Base(strings.TrimSuffix(exe, " (deleted)")) != filepath.Base(self) {
+		return false
+	}
+	started, err := processStartTime(pid)
+	if err != nil {
+		return false
+	}
+	switch {
+	case !info.Started.IsZero():
+		d := started.Sub(info.Started)
+		return d > -startTimeTolerance && d < startTimeTolerance
+	case !info.Written.IsZero():
+		return started.Before(info.Written.Add(startTimeTolerance))
+	}
+	return false
+}
+
+// clockTicks is the unit of the process start time in /proc/<pid>/stat
+// (USER_HZ), 100 on all common architectures.
+const clockTicks = 100
+
+// processStartTime returns the start time of the process identified by pid.
+func processStartTime(pid int) (time.Time, error) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return time.Time{}, err
+	}
+	// The command name, in parenthesis, may contain spaces: fields are
+	// counted from the closing parenthesis, the start time being the 22nd
+	// field of the line.
+	i := bytes.LastIndexByte(b, ')')
+	if i < 0 {
+		return time.Time{}, fmt.Errorf("invalid stat line for process %d", pid)
+	}
+	fields := strings.Fields(string(b[i+1:]))
+	if len(fields) < 20 {
+		return time.Time{}, fmt.Errorf("invalid stat line for process %d", pid)
+	}
+	ticks, err := strconv.ParseInt(fields[19], 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	boot, err := bootTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return boot.Add(time.Duration(ticks) * (time.Second / clockTicks)), nil
+}
+
+// bootTime returns the boot time of the system.
+func bootTime() (time.Time, error) {
+	b, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "btime ") {
+			sec, err := strconv.ParseInt(strings.TrimSpace(line[len("btime "):]), 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(sec, 0), nil
+		}
+	}
+	return time.Time{}, errors.New("boot time not found")
+}
+
+// shells are the process names of common interactive shells.
+var shells = map[string]bool{
+	"sh": true, "bash": true, "dash": true, "zsh": true, "ksh": true,
+	"fish": true, "csh": true, "tcsh": true,
+}
+
+// parentIsShell reports whether the parent of the current process is a shell,
+// hinting that the program runs without a supervisor.
+func parentIsShell() bool {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", os.Getppid()))
+	if err != nil {
+		return false
+	}
+	return shells[strings.TrimSpace(string(b))]
+}
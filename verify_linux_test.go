@@ -0,0 +1,87 @@
+package seamless
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestIsSeamlessProcess(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	cmd.Env = append(os.Environ(), "SEAMLESS=1")
+	if err := cmd.Start(); err != nil {
+		t.Skip(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	// The environment of the process may not be readable right after the
+	// exec.
+	deadline := time.Now().Add(testTimeout)
+	for !isSeamlessProcess(pidFileInfo{PID: cmd.Process.Pid}) {
+		if time.Now().After(deadline) {
+			t.Fatal("process started with SEAMLESS not recognized")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if isSeamlessProcess(pidFileInfo{PID: os.Getppid(), Written: time.Now()}) {
+		t.Error("parent process (go test) recognized as a seamless daemon")
+	}
+}
+
+func TestStartedIgnoresParentPID(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	newTestDaemon(t, pidFile)
+	logs := recordLogs(t)
+	sigs := recordSignals(t)
+	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getppid())), 0644); err != nil {
+		t.Fatal(err)
+	}
+	Started()
+	if s := sigs.signals(); len(s) != 0 {
+		t.Errorf("signals sent: %v", s)
+	}
+	if !logs.contains("is not a seamless daemon") {
+		t.Error("refusal not logged")
+	}
+}
+
+func TestIsSeamlessProcessStartTime(t *testing.T) {
+	// The test process runs the same executable as itself, without the
+	// SEAMLESS marker.
+	pid := os.Getpid()
+	tests := []struct {
+		name string
+		info pidFileInfo
+		want bool
+	}{
+		{"no start time", pidFileInfo{PID: pid}, false},
+		{"recorded start time", pidFileInfo{PID: pid, Started: startTime.Truncate(time.Second)}, true},
+		{"other start time", pidFileInfo{PID: pid, Started: startTime.Add(-time.Hour)}, false},
+		{"started before written", pidFileInfo{PID: pid, Written: time.Now()}, true},
+		// The PID recycled by a process started after the PID file was
+		// written.
+		{"started after written", pidFileInfo{PID: pid, Written: startTime.Add(-time.Hour)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSeamlessProcess(tt.info); got != tt.want {
+				t.Errorf("isSeamlessProcess() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessStartTime(t *testing.T) {
+	started, err := processStartTime(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := startTime.Sub(started); d < -startTimeTolerance || d > startTimeTolerance {
+		t.Errorf("process start time %v, want about %v", started, startTime)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package seamless
+
+// isSeamlessProcess can't verify the process on this platform and always
+// reports true.
+func isSeamlessProcess(info pidFileInfo) bool {
+	return true
+}
+
+// parentIsShell can't inspect the parent process on this platform and always
+// reports false.
+func parentIsShell() bool {
+	return false
+}
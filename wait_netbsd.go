@@ -0,0 +1,5 @@
+package seamless
+
+// waitContinued is the WCONTINUED wait option, not defined by the syscall
+// package on NetBSD.
+const waitContinued = 0x10
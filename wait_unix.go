@@ -0,0 +1,9 @@
+//go:build !windows && !netbsd
+// +build !windows,!netbsd
+
+package seamless
+
+import "syscall"
+
+// waitContinued is the WCONTINUED wait option.
+const waitContinued = syscall.WCONTINUED